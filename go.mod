@@ -8,10 +8,10 @@ require (
 	github.com/hashicorp/go-version v1.7.0
 	github.com/kardianos/osext v0.0.0-20190222173326-2bc1f35cddc0
 	github.com/koron/go-ssdp v0.0.4
+	golang.org/x/net v0.32.0
 	golang.org/x/text v0.21.0
 )
 
 require (
-	golang.org/x/net v0.32.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
 )
@@ -37,12 +37,13 @@ menuItems.push(new MainMenuItem("logout", "{{.mainMenu.item.logout}}", "logout.p
 // Kategorien für die Einstellungen
 var settingsCategory = new Array();
 //settingsCategory.push(new SettingsCategoryItem("{{.settings.category.general}}", "ThreadfinAutoUpdate,ssdp,tuner,epgSource,epgCategories,epgCategoriesColors,dummy,dummyChannel,ignoreFilters,api"));
-settingsCategory.push(new SettingsCategoryItem("{{.settings.category.general}}", "ssdp,tuner,epgSource,epgCategories,epgCategoriesColors,dummy,dummyChannel,ignoreFilters,api"));
+settingsCategory.push(new SettingsCategoryItem("{{.settings.category.general}}", "ssdp,tuner,tuner.queue.sec,epgSource,epgCategories,epgCategoriesColors,dummy,dummyChannel,ignoreFilters,api"));
 settingsCategory.push(new SettingsCategoryItem("{{.settings.category.files}}", "update,files.update,temp.path,cache.images,bindIpAddress,httpThreadfinDomain,forceHttps,httpsPort,httpsThreadfinDomain,xepg.replace.missing.images,xepg.replace.channel.title,enableNonAscii"));
 // settingsCategory.push(new SettingsCategoryItem("{{.settings.category.streaming}}", "udpxy,buffer.size.kb,buffer.timeout,user.agent,ffmpeg.path,ffmpeg.options,ffmpeg.forceHttp,vlc.path,vlc.options"));
-settingsCategory.push(new SettingsCategoryItem("{{.settings.category.streaming}}", "udpxy,buffer.size.kb,buffer.timeout,user.agent"));
+settingsCategory.push(new SettingsCategoryItem("{{.settings.category.streaming}}", "udpxy,udp.interface,buffer.size.kb,buffer.timeout,storeBufferInRAM,buffer.quota.stream.mb,buffer.quota.total.mb,buffer.timeshift.minutes,buffer.failback.minutes,buffer.linger.sec,buffer.slates,m3u8.adaptive.bandwidth.mbps,stream.head.probe,transcode.path,user.agent"));
+settingsCategory.push(new SettingsCategoryItem("{{.settings.category.recordings}}", "recordings.path,recording.padding.start.minutes,recording.padding.end.minutes"));
 settingsCategory.push(new SettingsCategoryItem("{{.settings.category.backup}}", "backup.path,backup.keep"));
-settingsCategory.push(new SettingsCategoryItem("{{.settings.category.authentication}}", "authentication.web,authentication.pms,authentication.m3u,authentication.xml,authentication.api"));
+settingsCategory.push(new SettingsCategoryItem("{{.settings.category.authentication}}", "authentication.web,authentication.pms,authentication.m3u,authentication.xml,authentication.api,stream.signing,stream.signing.expiry.hours,stream.signing.grace.hours"));
 function showPopUpElement(elm) {
     showElement(elm, true);
     return;
@@ -1116,9 +1116,8 @@ function openPopUp(dataType, element) {
             var input = content.createInput("text", dbKey, data[dbKey]);
             input.setAttribute("placeholder", "{{.playlist.fileM3U.placeholder}}");
             content.appendRow("{{.playlist.fileM3U.title}}", input);
-            /* Removing buffer selection for m3u8
-            var text = ["-", "FFmpeg", "VLC"];
-            var values = ["-", "ffmpeg", "vlc"];
+            var text = ["FFmpeg", "Threadfin"];
+            var values = ["ffmpeg", "threadfin"];
             var selected = SERVER["settings"]["buffer"];
             if (data["buffer"] != undefined) {
                 selected = data["buffer"];
@@ -1126,7 +1125,19 @@ function openPopUp(dataType, element) {
             var select = content.createSelect(text, values, selected, "buffer");
             select.setAttribute("id", "buffer");
             content.appendRow("{{.playlist.buffer.title}}", select);
-            */
+            // Buffer profile
+            var text = ["-"];
+            var values = [""];
+            var profiles = SERVER["settings"]["buffer.profiles"];
+            if (profiles != undefined && profiles != null) {
+                Object.keys(profiles).sort().forEach(name => {
+                    text.push(name);
+                    values.push(name);
+                });
+            }
+            var select = content.createSelect(text, values, data["buffer.profile"], "buffer.profile");
+            select.setAttribute("id", "buffer.profile");
+            content.appendRow("{{.playlist.bufferProfile.title}}", select);
             // Tuner
             var text = new Array();
             var values = new Array();
@@ -1159,6 +1170,30 @@ function openPopUp(dataType, element) {
             input.setAttribute("placeholder", "{{.playlist.http_user_referer.placeholder}}");
             content.appendRow("{{.playlist.http_user_referer.title}}", input);
             content.description("{{.playlist.http_user_referer.description}}");
+            var dbKey = "http_headers";
+            var value = data[dbKey];
+            if (value != undefined && typeof value == "object") {
+                value = Object.keys(value).map(name => name + ": " + value[name]).join("|");
+            }
+            var input = content.createInput("text", dbKey, value);
+            input.setAttribute("placeholder", "{{.playlist.http_headers.placeholder}}");
+            content.appendRow("{{.playlist.http_headers.title}}", input);
+            content.description("{{.playlist.http_headers.description}}");
+            var dbKey = "http_headers.user_agent";
+            var input = content.createInput("text", dbKey, data[dbKey]);
+            input.setAttribute("placeholder", "{{.playlist.http_user_agent.placeholder}}");
+            content.appendRow("{{.playlist.http_user_agent.title}}", input);
+            content.description("{{.playlist.http_user_agent.description}}");
+            var dbKey = "http_headers.cookies";
+            var input = content.createInput("text", dbKey, data[dbKey]);
+            input.setAttribute("placeholder", "{{.playlist.http_cookies.placeholder}}");
+            content.appendRow("{{.playlist.http_cookies.title}}", input);
+            content.description("{{.playlist.http_cookies.description}}");
+            var dbKey = "http_headers.cookie_jar";
+            var input = content.createCheckbox(dbKey);
+            input.checked = data[dbKey] == true;
+            content.appendRow("{{.playlist.http_cookie_jar.title}}", input);
+            content.description("{{.playlist.http_cookie_jar.description}}");
             // Interaktion
             content.createInteraction();
             // Löschen
@@ -1205,9 +1240,8 @@ function openPopUp(dataType, element) {
             var input = content.createInput("text", dbKey, data[dbKey]);
             input.setAttribute("placeholder", "{{.playlist.fileHDHR.placeholder}}");
             content.appendRow("{{.playlist.fileHDHR.title}}", input);
-            /* Removing buffer option
-            var text = ["-", "FFmpeg", "VLC"];
-            var values = ["-", "ffmpeg", "vlc"];
+            var text = ["FFmpeg", "Threadfin"];
+            var values = ["ffmpeg", "threadfin"];
             var selected = SERVER["settings"]["buffer"];
             if (data["buffer"] != undefined) {
                 selected = data["buffer"];
@@ -1215,7 +1249,19 @@ function openPopUp(dataType, element) {
             var select = content.createSelect(text, values, selected, "buffer");
             select.setAttribute("id", "buffer");
             content.appendRow("{{.playlist.buffer.title}}", select);
-            */
+            // Buffer profile
+            var text = ["-"];
+            var values = [""];
+            var profiles = SERVER["settings"]["buffer.profiles"];
+            if (profiles != undefined && profiles != null) {
+                Object.keys(profiles).sort().forEach(name => {
+                    text.push(name);
+                    values.push(name);
+                });
+            }
+            var select = content.createSelect(text, values, data["buffer.profile"], "buffer.profile");
+            select.setAttribute("id", "buffer.profile");
+            content.appendRow("{{.playlist.bufferProfile.title}}", select);
             // Tuner
             var text = new Array();
             var values = new Array();
@@ -1238,6 +1284,30 @@ function openPopUp(dataType, element) {
             input.setAttribute("placeholder", "{{.playlist.http_proxy_port.placeholder}}");
             content.appendRow("{{.playlist.http_proxy_port.title}}", input);
             content.description("{{.playlist.http_proxy_port.description}}");
+            var dbKey = "http_headers";
+            var value = data[dbKey];
+            if (value != undefined && typeof value == "object") {
+                value = Object.keys(value).map(name => name + ": " + value[name]).join("|");
+            }
+            var input = content.createInput("text", dbKey, value);
+            input.setAttribute("placeholder", "{{.playlist.http_headers.placeholder}}");
+            content.appendRow("{{.playlist.http_headers.title}}", input);
+            content.description("{{.playlist.http_headers.description}}");
+            var dbKey = "http_headers.user_agent";
+            var input = content.createInput("text", dbKey, data[dbKey]);
+            input.setAttribute("placeholder", "{{.playlist.http_user_agent.placeholder}}");
+            content.appendRow("{{.playlist.http_user_agent.title}}", input);
+            content.description("{{.playlist.http_user_agent.description}}");
+            var dbKey = "http_headers.cookies";
+            var input = content.createInput("text", dbKey, data[dbKey]);
+            input.setAttribute("placeholder", "{{.playlist.http_cookies.placeholder}}");
+            content.appendRow("{{.playlist.http_cookies.title}}", input);
+            content.description("{{.playlist.http_cookies.description}}");
+            var dbKey = "http_headers.cookie_jar";
+            var input = content.createCheckbox(dbKey);
+            input.checked = data[dbKey] == true;
+            content.appendRow("{{.playlist.http_cookie_jar.title}}", input);
+            content.description("{{.playlist.http_cookie_jar.description}}");
             // Interaktion
             content.createInteraction();
             // Löschen
@@ -1431,6 +1501,30 @@ function openPopUp(dataType, element) {
             input.setAttribute("placeholder", "{{.xmltv.http_proxy_port.placeholder}}");
             content.appendRow("{{.xmltv.http_proxy_port.title}}", input);
             content.description("{{.xmltv.http_proxy_port.description}}");
+            var dbKey = "http_headers";
+            var value = data[dbKey];
+            if (value != undefined && typeof value == "object") {
+                value = Object.keys(value).map(name => name + ": " + value[name]).join("|");
+            }
+            var input = content.createInput("text", dbKey, value);
+            input.setAttribute("placeholder", "{{.xmltv.http_headers.placeholder}}");
+            content.appendRow("{{.xmltv.http_headers.title}}", input);
+            content.description("{{.xmltv.http_headers.description}}");
+            var dbKey = "http_headers.user_agent";
+            var input = content.createInput("text", dbKey, data[dbKey]);
+            input.setAttribute("placeholder", "{{.xmltv.http_user_agent.placeholder}}");
+            content.appendRow("{{.xmltv.http_user_agent.title}}", input);
+            content.description("{{.xmltv.http_user_agent.description}}");
+            var dbKey = "http_headers.cookies";
+            var input = content.createInput("text", dbKey, data[dbKey]);
+            input.setAttribute("placeholder", "{{.xmltv.http_cookies.placeholder}}");
+            content.appendRow("{{.xmltv.http_cookies.title}}", input);
+            content.description("{{.xmltv.http_cookies.description}}");
+            var dbKey = "http_headers.cookie_jar";
+            var input = content.createCheckbox(dbKey);
+            input.checked = data[dbKey] == true;
+            content.appendRow("{{.xmltv.http_cookie_jar.title}}", input);
+            content.description("{{.xmltv.http_cookie_jar.description}}");
             // Interaktion
             content.createInteraction();
             // Löschen
@@ -1635,40 +1729,39 @@ function openPopUp(dataType, element) {
                 input.setAttribute("id", "ppv-extra");
                 content.appendRow("{{.mapping.ppvextra.title}}", input);
             }
-            var dbKey = "x-backup-channel-1";
-            var xmltv = new XMLTVFile();
-            const backup1XmlTvId = data[dbKey];
-            const [xmlTvBackup1IdContainer, xmlTvBackup1IdInput, xmlTvBackup1IdDatalist] = xmltv.newM3uPicker(xmlFile, backup1XmlTvId);
-            xmlTvBackup1IdContainer.setAttribute('id', 'm3u-id-picker-container-1');
-            xmlTvBackup1IdInput.setAttribute('list', 'm3u-id-picker-datalist');
-            xmlTvBackup1IdInput.setAttribute('name', dbKey); // Should stay x-mapping as it will be used in donePopupData to make a server request
-            xmlTvBackup1IdInput.setAttribute("id", "backup-channel-1");
-            xmlTvBackup1IdInput.setAttribute('onchange', `javascript: this.className = 'changed'; checkXmltvChannel('${id}', this, '${xmlFile}');`);
-            xmlTvBackup1IdDatalist.setAttribute('id', 'm3u-id-picker-datalist');
-            // sortSelect(xmlTvIdDatalist); // TODO: Better sort before adding
-            content.appendRow('{{.mapping.backupChannel1.title}}', xmlTvBackup1IdContainer);
-            var dbKey = "x-backup-channel-2";
-            var xmltv = new XMLTVFile();
-            const backup2XmlTvId = data[dbKey];
-            const [xmlTvBackup2IdContainer, xmlTvBackup2IdInput, xmlTvBackup2IdDatalist] = xmltv.newM3uPicker(xmlFile, backup2XmlTvId);
-            xmlTvBackup2IdContainer.setAttribute('id', 'xmltv-id-picker-container-2');
-            xmlTvBackup2IdInput.setAttribute('list', 'm3u-id-picker-datalist');
-            xmlTvBackup2IdInput.setAttribute('name', dbKey); // Should stay x-mapping as it will be used in donePopupData to make a server request
-            xmlTvBackup2IdInput.setAttribute("id", "backup-channel-2");
-            xmlTvBackup2IdInput.setAttribute('onchange', `javascript: this.className = 'changed'; checkXmltvChannel('${id}', this, '${xmlFile}');`);
-            xmlTvBackup2IdDatalist.setAttribute('id', 'm3u-id-picker-datalist');
-            content.appendRow("{{.mapping.backupChannel2.title}}", xmlTvBackup2IdContainer);
-            var dbKey = "x-backup-channel-3";
-            var xmltv = new XMLTVFile();
-            const backup3XmlTvId = data[dbKey];
-            const [xmlTvBackup3IdContainer, xmlTvBackup3IdInput, xmlTvBackup3IdDatalist] = xmltv.newM3uPicker(xmlFile, backup3XmlTvId);
-            xmlTvBackup3IdContainer.setAttribute('id', 'xmltv-id-picker-container-3');
-            xmlTvBackup3IdInput.setAttribute('list', 'm3u-id-picker-datalist');
-            xmlTvBackup3IdInput.setAttribute('name', dbKey); // Should stay x-mapping as it will be used in donePopupData to make a server request
-            xmlTvBackup3IdInput.setAttribute("id", "backup-channel-3");
-            xmlTvBackup3IdInput.setAttribute('onchange', `javascript: this.className = 'changed'; checkXmltvChannel('${id}', this, '${xmlFile}');`);
-            xmlTvBackup3IdDatalist.setAttribute('id', 'm3u-id-picker-datalist');
-            content.appendRow("{{.mapping.backupChannel3.title}}", xmlTvBackup3IdContainer);
+            // Backup channels
+            var dbKey = "x-backup-channels";
+            var backupChannels = new BackupChannelList(data[dbKey]);
+            content.appendRow("{{.mapping.backupChannels.title}}", backupChannels.createList(dbKey));
+            content.description("{{.mapping.backupChannels.description}}");
+            // Buffer profile
+            var dbKey = "x-buffer-profile";
+            var text = ["-"];
+            var values = [""];
+            var profiles = SERVER["settings"]["buffer.profiles"];
+            if (profiles != undefined && profiles != null) {
+                Object.keys(profiles).sort().forEach(name => {
+                    text.push(name);
+                    values.push(name);
+                });
+            }
+            var select = content.createSelect(text, values, data[dbKey], dbKey);
+            select.setAttribute("onchange", "javascript: this.className = 'changed'");
+            content.appendRow("{{.mapping.bufferProfile.title}}", select);
+            // Time shift
+            var dbKey = "x-timeshift";
+            var input = content.createInput("text", dbKey, data[dbKey]);
+            input.setAttribute("placeholder", "{{.mapping.timeShift.placeholder}}");
+            input.setAttribute("onchange", "javascript: this.className = 'changed'");
+            content.appendRow("{{.mapping.timeShift.title}}", input);
+            content.description("{{.mapping.timeShift.description}}");
+            // Keep warm
+            var dbKey = "x-keep-warm";
+            var input = content.createCheckbox(dbKey);
+            input.checked = data[dbKey] == true;
+            input.setAttribute("onchange", "javascript: this.className = 'changed'");
+            content.appendRow("{{.mapping.keepWarm.title}}", input);
+            content.description("{{.mapping.keepWarm.description}}");
             // Interaktion
             content.createInteraction();
             var input = content.createInput("button", "cancel", "{{.button.probeChannel}}");
@@ -1704,6 +1797,114 @@ function openPopUp(dataType, element) {
     }
     showPopUpElement('popup-custom');
 }
+class BackupChannelList {
+    constructor(sources) {
+        this.sources = (Array.isArray(sources)) ? sources.slice() : [];
+        // Channels of all playlists, the name in the list is "tvg-name (playlist)"
+        this.channels = new Object();
+        const m3u = SERVER['xepg']['epgMapping'];
+        if (m3u) {
+            getOwnObjProps(m3u).forEach((xepgID) => {
+                const channel = m3u[xepgID];
+                const tvgName = (channel["tvg-name"]) ? channel["tvg-name"] : channel["name"];
+                const reference = (channel["_uuid.value"]) ? channel["_uuid.value"] : tvgName;
+                this.channels[tvgName + " (" + channel["_file.m3u.name"] + ")"] = { "playlistID": channel["_file.m3u.id"], "channel": reference };
+            });
+        }
+    }
+    createList(dbKey) {
+        const container = document.createElement("DIV");
+        // The list is sent to the server as JSON
+        this.input = document.createElement("INPUT");
+        this.input.setAttribute("type", "hidden");
+        this.input.setAttribute("name", dbKey);
+        this.input.value = JSON.stringify(this.sources);
+        container.appendChild(this.input);
+        const datalist = document.createElement("DATALIST");
+        datalist.setAttribute("id", "backup-channels-datalist");
+        getOwnObjProps(this.channels).sort().forEach((name) => {
+            const option = document.createElement("OPTION");
+            option.setAttribute("value", name);
+            datalist.appendChild(option);
+        });
+        container.appendChild(datalist);
+        this.list = document.createElement("DIV");
+        container.appendChild(this.list);
+        const add = document.createElement("INPUT");
+        add.setAttribute("type", "button");
+        add.setAttribute("value", "{{.button.new}}");
+        add.addEventListener("click", () => {
+            this.sources.push({ "playlistID": "", "channel": "" });
+            this.render();
+        });
+        container.appendChild(add);
+        this.render();
+        return container;
+    }
+    render() {
+        this.list.innerHTML = "";
+        this.sources.forEach((source, i) => {
+            const row = document.createElement("DIV");
+            const input = document.createElement("INPUT");
+            input.setAttribute("type", "text");
+            input.setAttribute("list", "backup-channels-datalist");
+            input.setAttribute("placeholder", "{{.mapping.backupChannels.placeholder}}");
+            input.value = this.getName(source);
+            input.addEventListener("change", (evt) => {
+                this.setSource(i, evt.target.value);
+            });
+            row.appendChild(input);
+            row.appendChild(this.createButton("\u25B2", () => this.move(i, -1)));
+            row.appendChild(this.createButton("\u25BC", () => this.move(i, 1)));
+            row.appendChild(this.createButton("\u2715", () => this.remove(i)));
+            this.list.appendChild(row);
+        });
+    }
+    createButton(text, action) {
+        const button = document.createElement("INPUT");
+        button.setAttribute("type", "button");
+        button.setAttribute("value", text);
+        button.addEventListener("click", action);
+        return button;
+    }
+    getName(source) {
+        for (const name in this.channels) {
+            const channel = this.channels[name];
+            if (channel["playlistID"] == source["playlistID"] && channel["channel"] == source["channel"]) {
+                return name;
+            }
+        }
+        return source["channel"];
+    }
+    setSource(i, name) {
+        name = name.trim();
+        if (this.channels.hasOwnProperty(name)) {
+            this.sources[i] = Object.assign({}, this.channels[name]);
+        }
+        else {
+            this.sources[i] = { "playlistID": "", "channel": name };
+        }
+        this.changed();
+    }
+    move(i, offset) {
+        const target = i + offset;
+        if (target < 0 || target >= this.sources.length) {
+            return;
+        }
+        [this.sources[i], this.sources[target]] = [this.sources[target], this.sources[i]];
+        this.changed();
+    }
+    remove(i) {
+        this.sources.splice(i, 1);
+        this.changed();
+    }
+    changed() {
+        const sources = this.sources.filter(source => source["channel"] != "" && source["channel"] != "-");
+        this.input.value = JSON.stringify(sources);
+        this.input.className = "changed";
+        this.render();
+    }
+}
 class XMLTVFile {
     getFiles(set) {
         var fileIDs = getObjKeys(SERVER["xepg"]["xmltvMap"]);
@@ -1785,52 +1986,6 @@ class XMLTVFile {
         container.appendChild(datalist);
         return [container, input, datalist];
     }
-    newM3uPicker(xmlTvFile, currentXmlTvId) {
-        const container = document.createElement('div');
-        const input = document.createElement('input');
-        input.setAttribute('type', 'text');
-        // Initially, set value to '-' if input is empty
-        input.value = (currentXmlTvId) ? currentXmlTvId : '-';
-        // When input is focused, remove '-' from it
-        input.addEventListener('focus', (evt) => {
-            const target = evt.target;
-            target.value = (target.value === '-') ? '' : target.value;
-        });
-        // When input lose focus or take a value, if it's empty, set value to '-'
-        input.addEventListener('blur', setFallbackValue);
-        input.addEventListener('change', setFallbackValue);
-        function setFallbackValue(evt) {
-            const target = evt.target;
-            target.value = (target.value) ? target.value : '-';
-        }
-        container.appendChild(input);
-        const datalist = document.createElement('datalist');
-        const option = document.createElement('option');
-        option.setAttribute('value', '-');
-        option.innerText = '-';
-        datalist.appendChild(option);
-        const m3u = SERVER['xepg']['epgMapping'];
-        if (m3u) {
-            const programIds = getOwnObjProps(m3u);
-            programIds.forEach((programId) => {
-                const chanel = m3u[programId];
-                if (chanel.hasOwnProperty('tvg-name')) {
-                    const option = document.createElement('option');
-                    option.setAttribute('value', chanel["tvg-name"]);
-                    option.innerText = programId;
-                    datalist.appendChild(option);
-                }
-                else {
-                    const option = document.createElement('option');
-                    option.setAttribute('value', chanel["tvg-name"]);
-                    option.innerText = '-';
-                    datalist.appendChild(option);
-                }
-            });
-        }
-        container.appendChild(datalist);
-        return [container, input, datalist];
-    }
     getPrograms(file, set, active) {
         //var fileIDs:string[] = getObjKeys(SERVER["xepg"]["xmltvMap"])
         var values = getObjKeys(SERVER["xepg"]["xmltvMap"][file]);
@@ -2172,6 +2327,11 @@ function donePopupData(dataType, idsStr) {
                             value = inputs[i].value;
                             input[name] = value;
                             break;
+                        case "hidden":
+                            name = inputs[i].name;
+                            value = JSON.parse(inputs[i].value);
+                            input[name] = value;
+                            break;
                     }
                     break;
                 case "SELECT":
@@ -2220,9 +2380,6 @@ function donePopupData(dataType, idsStr) {
                     }
                     document.getElementById(id).childNodes[7].firstChild.innerHTML = value;
                     break;
-                case "x-backup-channel":
-                    document.getElementById(id).childNodes[7].firstChild.innerHTML = value;
-                    break;
                 case "x-hide-channel":
                     document.getElementById(id).childNodes[7].firstChild.innerHTML = value;
                     break;
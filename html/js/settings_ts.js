@@ -38,6 +38,39 @@ class SettingsCategory {
                 setting.appendChild(tdLeft);
                 setting.appendChild(tdRight);
                 break;
+            case "recordings.path":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.recordingsPath.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data);
+                input.setAttribute("placeholder", "{{.settings.recordingsPath.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "recording.padding.start.minutes":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.recordingPaddingStart.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data.toString());
+                input.setAttribute("placeholder", "{{.settings.recordingPaddingStart.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "recording.padding.end.minutes":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.recordingPaddingEnd.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data.toString());
+                input.setAttribute("placeholder", "{{.settings.recordingPaddingEnd.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
             case "temp.path":
                 var tdLeft = document.createElement("TD");
                 tdLeft.innerHTML = "{{.settings.tempPath.title}}" + ":";
@@ -182,9 +215,9 @@ class SettingsCategory {
                 setting.appendChild(tdLeft);
                 setting.appendChild(tdRight);
                 break;
-            case "files.update":
+            case "stream.signing":
                 var tdLeft = document.createElement("TD");
-                tdLeft.innerHTML = "{{.settings.filesUpdate.title}}" + ":";
+                tdLeft.innerHTML = "{{.settings.streamSigning.title}}" + ":";
                 var tdRight = document.createElement("TD");
                 var input = content.createCheckbox(settingsKey);
                 input.checked = data;
@@ -193,9 +226,31 @@ class SettingsCategory {
                 setting.appendChild(tdLeft);
                 setting.appendChild(tdRight);
                 break;
-            case "cache.images":
+            case "stream.signing.expiry.hours":
                 var tdLeft = document.createElement("TD");
-                tdLeft.innerHTML = "{{.settings.cacheImages.title}}" + ":";
+                tdLeft.innerHTML = "{{.settings.streamSigningExpiry.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data.toString());
+                input.setAttribute("placeholder", "{{.settings.streamSigningExpiry.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "stream.signing.grace.hours":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.streamSigningGrace.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data.toString());
+                input.setAttribute("placeholder", "{{.settings.streamSigningGrace.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "files.update":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.filesUpdate.title}}" + ":";
                 var tdRight = document.createElement("TD");
                 var input = content.createCheckbox(settingsKey);
                 input.checked = data;
@@ -204,9 +259,9 @@ class SettingsCategory {
                 setting.appendChild(tdLeft);
                 setting.appendChild(tdRight);
                 break;
-            case "xepg.replace.missing.images":
+            case "cache.images":
                 var tdLeft = document.createElement("TD");
-                tdLeft.innerHTML = "{{.settings.replaceEmptyImages.title}}" + ":";
+                tdLeft.innerHTML = "{{.settings.cacheImages.title}}" + ":";
                 var tdRight = document.createElement("TD");
                 var input = content.createCheckbox(settingsKey);
                 input.checked = data;
@@ -215,9 +270,9 @@ class SettingsCategory {
                 setting.appendChild(tdLeft);
                 setting.appendChild(tdRight);
                 break;
-            case "xepg.replace.channel.title":
+            case "xepg.replace.missing.images":
                 var tdLeft = document.createElement("TD");
-                tdLeft.innerHTML = "{{.settings.replaceChannelTitle.title}}" + ":";
+                tdLeft.innerHTML = "{{.settings.replaceEmptyImages.title}}" + ":";
                 var tdRight = document.createElement("TD");
                 var input = content.createCheckbox(settingsKey);
                 input.checked = data;
@@ -226,9 +281,9 @@ class SettingsCategory {
                 setting.appendChild(tdLeft);
                 setting.appendChild(tdRight);
                 break;
-            case "storeBufferInRAM":
+            case "xepg.replace.channel.title":
                 var tdLeft = document.createElement("TD");
-                tdLeft.innerHTML = "{{.settings.storeBufferInRAM.title}}" + ":";
+                tdLeft.innerHTML = "{{.settings.replaceChannelTitle.title}}" + ":";
                 var tdRight = document.createElement("TD");
                 var input = content.createCheckbox(settingsKey);
                 input.checked = data;
@@ -446,6 +501,116 @@ class SettingsCategory {
                 setting.appendChild(tdLeft);
                 setting.appendChild(tdRight);
                 break;
+            case "m3u8.adaptive.bandwidth.mbps":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.m3u8AdaptiveBandwidth.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data.toString());
+                input.setAttribute("placeholder", "{{.settings.m3u8AdaptiveBandwidth.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "buffer.linger.sec":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.bufferLinger.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data.toString());
+                input.setAttribute("placeholder", "{{.settings.bufferLinger.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "buffer.slates":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.bufferSlates.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createCheckbox(settingsKey);
+                input.checked = data;
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "stream.head.probe":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.streamHeadProbe.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createCheckbox(settingsKey);
+                input.checked = data;
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "storeBufferInRAM":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.storeBufferInRAM.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createCheckbox(settingsKey);
+                input.checked = data;
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "buffer.quota.stream.mb":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.bufferQuotaStream.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data.toString());
+                input.setAttribute("placeholder", "{{.settings.bufferQuotaStream.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "buffer.quota.total.mb":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.bufferQuotaTotal.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data.toString());
+                input.setAttribute("placeholder", "{{.settings.bufferQuotaTotal.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "buffer.timeshift.minutes":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.bufferTimeShift.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data.toString());
+                input.setAttribute("placeholder", "{{.settings.bufferTimeShift.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "tuner.queue.sec":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.tunerQueue.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data.toString());
+                input.setAttribute("placeholder", "{{.settings.tunerQueue.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "buffer.failback.minutes":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.bufferFailback.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data.toString());
+                input.setAttribute("placeholder", "{{.settings.bufferFailback.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
             /* removing all buffer options
             case "buffer":
                 var tdLeft = document.createElement("TD");
@@ -471,6 +636,28 @@ class SettingsCategory {
                 setting.appendChild(tdLeft);
                 setting.appendChild(tdRight);
                 break;
+            case "transcode.path":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.transcodePath.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data);
+                input.setAttribute("placeholder", "{{.settings.transcodePath.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
+            case "udp.interface":
+                var tdLeft = document.createElement("TD");
+                tdLeft.innerHTML = "{{.settings.udpInterface.title}}" + ":";
+                var tdRight = document.createElement("TD");
+                var input = content.createInput("text", settingsKey, data);
+                input.setAttribute("placeholder", "{{.settings.udpInterface.placeholder}}");
+                input.setAttribute("onchange", "javascript: this.className = 'changed'");
+                tdRight.appendChild(input);
+                setting.appendChild(tdLeft);
+                setting.appendChild(tdRight);
+                break;
         }
         return setting;
     }
@@ -495,6 +682,15 @@ class SettingsCategory {
                     text = "{{.settings.authenticationAPI.description}}";
                 }
                 break;
+            case "stream.signing":
+                text = "{{.settings.streamSigning.description}}";
+                break;
+            case "stream.signing.expiry.hours":
+                text = "{{.settings.streamSigningExpiry.description}}";
+                break;
+            case "stream.signing.grace.hours":
+                text = "{{.settings.streamSigningGrace.description}}";
+                break;
             /* Remove Threadfin Auto Update
             case "ThreadfinAutoUpdate":
                 text = "{{.settings.ThreadfinAutoUpdate.description}}";
@@ -506,6 +702,15 @@ class SettingsCategory {
             case "backup.path":
                 text = "{{.settings.backupPath.description}}";
                 break;
+            case "recordings.path":
+                text = "{{.settings.recordingsPath.description}}";
+                break;
+            case "recording.padding.start.minutes":
+                text = "{{.settings.recordingPaddingStart.description}}";
+                break;
+            case "recording.padding.end.minutes":
+                text = "{{.settings.recordingPaddingEnd.description}}";
+                break;
             case "temp.path":
                 text = "{{.settings.tempPath.description}}";
                 break;
@@ -520,6 +725,30 @@ class SettingsCategory {
             case "storeBufferInRAM":
                 text = "{{.settings.storeBufferInRAM.description}}";
                 break;
+            case "buffer.quota.stream.mb":
+                text = "{{.settings.bufferQuotaStream.description}}";
+                break;
+            case "buffer.quota.total.mb":
+                text = "{{.settings.bufferQuotaTotal.description}}";
+                break;
+            case "buffer.timeshift.minutes":
+                text = "{{.settings.bufferTimeShift.description}}";
+                break;
+            case "buffer.failback.minutes":
+                text = "{{.settings.bufferFailback.description}}";
+                break;
+            case "buffer.linger.sec":
+                text = "{{.settings.bufferLinger.description}}";
+                break;
+            case "buffer.slates":
+                text = "{{.settings.bufferSlates.description}}";
+                break;
+            case "stream.head.probe":
+                text = "{{.settings.streamHeadProbe.description}}";
+                break;
+            case "m3u8.adaptive.bandwidth.mbps":
+                text = "{{.settings.m3u8AdaptiveBandwidth.description}}";
+                break;
             case "forceHttps":
                 text = "{{.settings.forceHttps.description}}";
                 break;
@@ -573,6 +802,9 @@ class SettingsCategory {
             case "tuner":
                 text = "{{.settings.tuner.description}}";
                 break;
+            case "tuner.queue.sec":
+                text = "{{.settings.tunerQueue.description}}";
+                break;
             case "update":
                 text = "{{.settings.update.description}}";
                 break;
@@ -597,6 +829,12 @@ class SettingsCategory {
             case "udpxy":
                 text = "{{.settings.udpxy.description}}";
                 break;
+            case "udp.interface":
+                text = "{{.settings.udpInterface.description}}";
+                break;
+            case "transcode.path":
+                text = "{{.settings.transcodePath.description}}";
+                break;
             default:
                 text = "";
                 break;
@@ -679,6 +917,20 @@ function saveSettings() {
                                 break;
                             case "buffer.timeout":
                                 value = parseFloat(value);
+                                break;
+                            case "buffer.quota.stream.mb":
+                            case "buffer.quota.total.mb":
+                            case "buffer.timeshift.minutes":
+                            case "buffer.failback.minutes":
+                            case "buffer.linger.sec":
+                            case "tuner.queue.sec":
+                            case "m3u8.adaptive.bandwidth.mbps":
+                            case "recording.padding.start.minutes":
+                            case "recording.padding.end.minutes":
+                            case "stream.signing.expiry.hours":
+                            case "stream.signing.grace.hours":
+                                value = parseInt(value);
+                                break;
                         }
                         newSettings[name] = value;
                         break;
@@ -132,6 +132,61 @@ func urlAuth(r *http.Request, requestType string) (err error) {
 	return
 }
 
+// getRequestUser : Authenticated user of a request (HTTP basic authentication or URL parameters), empty without valid credentials
+func getRequestUser(r *http.Request) (username string) {
+
+	var password string
+	var ok bool
+
+	// User of a signed streaming URL, the signature was already verified
+	if user, ok := r.Context().Value(streamUserKey{}).(string); ok {
+		return user
+	}
+
+	username, password, ok = r.BasicAuth()
+	if !ok {
+		username = r.URL.Query().Get("username")
+		password = r.URL.Query().Get("password")
+	}
+
+	if len(username) == 0 {
+		return
+	}
+
+	if _, err := authentication.UserAuthentication(username, password); err != nil {
+		return ""
+	}
+
+	return
+}
+
+// userExists : Checks whether a user with this name exists in the user database
+func userExists(username string) bool {
+
+	users, err := authentication.GetAllUserData()
+	if err != nil {
+		return false
+	}
+
+	for _, u := range users {
+
+		var user, ok = u.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var hash, _ = user["_username"].(string)
+		var salt, _ = user["_salt"].(string)
+
+		if len(hash) > 0 && authentication.SHA256(username, salt) == hash {
+			return true
+		}
+
+	}
+
+	return false
+}
+
 func checkAuthorizationLevel(token, level string) (err error) {
 
 	var authenticationErr = func(err error) {
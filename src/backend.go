@@ -0,0 +1,387 @@
+package src
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BufferBackend : Source of the stream data that is written into the buffer
+type BufferBackend interface {
+	// Start : Connects to the streaming server (or starts the process)
+	Start() error
+	// Read : Reads the next chunk of stream data
+	Read(p []byte) (n int, err error)
+	// Stop : Closes the connection and releases all resources, can be called more than once
+	Stop()
+	// Error : Reason why the backend has stopped, nil while it is running
+	Error() error
+}
+
+// newBufferBackend : Creates the backend for the buffer type of the playlist
+func newBufferBackend(playlist Playlist, profile BufferProfile, streamingURL string) (backend BufferBackend, err error) {
+
+	switch playlist.Buffer {
+
+	case "ffmpeg":
+		backend = newFFmpegBackend(playlist, profile, streamingURL)
+
+	case "threadfin":
+
+		// Multicast streams are received directly, unless they are rewritten to UDPxy
+		if isMulticastURL(streamingURL) {
+			backend = newMulticastBackend(streamingURL)
+			break
+		}
+
+		backend = newNativeBackend(playlist, profile, streamingURL)
+
+	default:
+		err = fmt.Errorf("Unknown buffer type: %s", playlist.Buffer)
+
+	}
+
+	return
+}
+
+// getBufferType : Buffer type of the provider. Falls back to the global buffer setting.
+func getBufferType(playlistID, playlistType string) (bufferType string) {
+
+	bufferType = getProviderParameter(playlistID, playlistType, "buffer")
+
+	switch bufferType {
+
+	case "ffmpeg", "threadfin":
+		return
+
+	}
+
+	switch Settings.Buffer {
+
+	case "threadfin":
+		bufferType = "threadfin"
+
+	default:
+		bufferType = "ffmpeg"
+
+	}
+
+	return
+}
+
+// getPlaylistType : Provider file type based on the playlist ID, empty for an unknown ID
+func getPlaylistType(playlistID string) (playlistType string) {
+
+	if len(playlistID) == 0 {
+		return
+	}
+
+	switch playlistID[0:1] {
+
+	case "M":
+		playlistType = "m3u"
+
+	case "H":
+		playlistType = "hdhr"
+
+	}
+
+	return
+}
+
+// --- FFmpeg ---
+
+// ffmpegBackend : Stream data from an FFmpeg process (or the yt-dlp wrapper)
+type ffmpegBackend struct {
+	path string
+	args []string
+	env  []string
+
+	cmd    *exec.Cmd
+	stdOut io.ReadCloser
+	logOut io.ReadCloser
+
+	// Data for the standard input of the process (pipe:0), nil if FFmpeg reads the streaming URL itself
+	input io.Reader
+
+	streaming bool
+	err       error
+	stop      sync.Once
+	mutex     sync.Mutex
+}
+
+func newFFmpegBackend(playlist Playlist, profile BufferProfile, streamingURL string) (backend *ffmpegBackend) {
+
+	backend = &ffmpegBackend{}
+	backend.path = profile.Path
+	backend.args = profile.buildBufferArgs(playlist, streamingURL)
+	backend.env = profile.buildBufferEnv()
+
+	return
+}
+
+func (b *ffmpegBackend) Start() (err error) {
+
+	err = checkFile(b.path)
+	if err != nil {
+		return
+	}
+
+	showInfo(fmt.Sprintf("FFMPEG path:%s", b.path))
+
+	b.cmd = exec.Command(b.path, b.args...)
+	b.cmd.Env = b.env
+
+	showDebug(fmt.Sprintf("BUFFER DEBUG: FFMPEG:%s %s", b.path, b.args), 1)
+
+	// Byte data from the process
+	b.stdOut, err = b.cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+
+	// Log data from the process
+	b.logOut, err = b.cmd.StderrPipe()
+	if err != nil {
+		return
+	}
+
+	var stdIn io.WriteCloser
+	if b.input != nil {
+
+		stdIn, err = b.cmd.StdinPipe()
+		if err != nil {
+			return
+		}
+
+	}
+
+	err = b.cmd.Start()
+	if err != nil {
+		return
+	}
+
+	// The input is written until it ends or the process is stopped, FFmpeg finishes the stream at the end of the input
+	if stdIn != nil {
+
+		go func() {
+			io.Copy(stdIn, b.input)
+			stdIn.Close()
+		}()
+
+	}
+
+	go func() {
+
+		// Display log data from the process, once the stream is running only in debug mode 1.
+		scanner := bufio.NewScanner(b.logOut)
+		scanner.Split(bufio.ScanLines)
+
+		for scanner.Scan() {
+
+			var debug = fmt.Sprintf("FFMPEG log:%s", strings.TrimSpace(scanner.Text()))
+
+			b.mutex.Lock()
+			var streaming = b.streaming
+			b.mutex.Unlock()
+
+			if streaming {
+				showDebug(debug, 1)
+			} else {
+				showInfo(debug)
+			}
+
+		}
+
+	}()
+
+	return
+}
+
+func (b *ffmpegBackend) Read(p []byte) (n int, err error) {
+
+	n, err = b.stdOut.Read(p)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if n > 0 {
+		b.streaming = true
+	}
+
+	if err != nil && b.err == nil {
+
+		b.err = err
+		if err == io.EOF {
+			b.err = errors.New("FFMPEG error")
+		}
+
+	}
+
+	return
+}
+
+func (b *ffmpegBackend) Stop() {
+
+	b.stop.Do(func() {
+
+		if b.cmd != nil && b.cmd.Process != nil {
+			showDebug("Buffer:Killing ffmpeg process...", 2)
+			b.cmd.Process.Kill()
+			b.cmd.Wait()
+		}
+
+	})
+
+}
+
+func (b *ffmpegBackend) Error() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.err
+}
+
+// --- Native (Threadfin) ---
+
+// nativeBackend : Proxies an HTTP MPEG-TS stream or downloads the segments of an HLS stream without an external process
+type nativeBackend struct {
+	url     string
+	headers http.Header
+	client  *http.Client
+	timeout time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	body   io.ReadCloser
+	ingest *hlsIngest // HLS streams
+
+	err   error
+	stop  sync.Once
+	mutex sync.Mutex
+}
+
+func newNativeBackend(playlist Playlist, profile BufferProfile, streamingURL string) (backend *nativeBackend) {
+
+	backend = &nativeBackend{}
+	backend.url = streamingURL
+	backend.headers = playlist.HTTP.Header()
+	backend.client = playlist.HTTP.Client()
+	backend.timeout = time.Duration(profile.StartupTimeout) * time.Second
+
+	backend.ctx, backend.cancel = context.WithCancel(context.Background())
+
+	return
+}
+
+func (b *nativeBackend) Start() (err error) {
+
+	req, err := http.NewRequestWithContext(b.ctx, "GET", b.url, nil)
+	if err != nil {
+		return
+	}
+
+	req.Header = b.headers.Clone()
+
+	// Only the time until the response headers arrive is limited, the body is streamed for as long as the client is connected
+	var timer = time.AfterFunc(b.timeout, b.cancel)
+
+	resp, err := b.client.Do(req)
+	timer.Stop()
+
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = fmt.Errorf("%d: %s (%s)", resp.StatusCode, http.StatusText(resp.StatusCode), getErrMsg(4004))
+		return
+	}
+
+	showInfo(fmt.Sprintf("Streaming Status:Content-Type: %s", resp.Header.Get("Content-Type")))
+
+	// HLS: The segments are downloaded by the buffer and read as continuous MPEG-TS stream
+	if isM3U8(resp) {
+
+		var body []byte
+
+		body, err = io.ReadAll(io.LimitReader(resp.Body, hlsPlaylistLimit))
+		resp.Body.Close()
+
+		if err != nil {
+			return
+		}
+
+		var ingest *hlsIngest
+
+		ingest, err = newHLSIngest(b, resp.Request.URL, body)
+		if err != nil {
+			return
+		}
+
+		b.body = ingest.reader
+		b.ingest = ingest
+		return
+	}
+
+	b.body = resp.Body
+
+	return
+}
+
+func (b *nativeBackend) Read(p []byte) (n int, err error) {
+
+	n, err = b.body.Read(p)
+
+	if err != nil {
+
+		b.mutex.Lock()
+		if b.err == nil {
+			b.err = err
+			if err == io.EOF {
+				b.err = errors.New(getErrMsg(4000))
+			}
+		}
+		b.mutex.Unlock()
+
+	}
+
+	return
+}
+
+// StallTimeout : Minimum stall timeout of the stream, HLS streams deliver their data in segments. 0 for continuous streams.
+func (b *nativeBackend) StallTimeout() time.Duration {
+
+	if b.ingest == nil {
+		return 0
+	}
+
+	return b.ingest.StallTimeout()
+}
+
+func (b *nativeBackend) Stop() {
+
+	b.stop.Do(func() {
+
+		b.cancel()
+
+		if b.body != nil {
+			b.body.Close()
+		}
+
+	})
+
+}
+
+func (b *nativeBackend) Error() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.err
+}
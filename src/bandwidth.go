@@ -0,0 +1,149 @@
+package src
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// StreamBandwidth : Bandwidth of an active stream, from the upstream (ingress) and to all its clients (egress)
+type StreamBandwidth struct {
+	PlaylistID    string `json:"playlistID"`
+	Provider      string `json:"provider"`
+	Channel       string `json:"channel"`
+	Source        string `json:"source"`
+	Transcode     string `json:"transcode,omitempty"`
+	Clients       int    `json:"clients"`
+	BitrateIn     int    `json:"bitrateIn"`  // bit/s
+	BitrateOut    int    `json:"bitrateOut"` // bit/s
+	BytesReceived int64  `json:"bytesReceived"`
+	BytesSent     int64  `json:"bytesSent"`
+
+	md5 string
+}
+
+// Interval in which the rolling average is updated
+const bandwidthInterval = time.Second
+
+// Time constant of the rolling average, older data only has a small influence on the bandwidth
+const bandwidthWindow = 10 * time.Second
+
+// Add : Counts the transferred data. After every bandwidthInterval the rolling average (bit/s) is updated and true is returned.
+// Add(0) updates the average without new data, the bandwidth of an idle transfer drops to 0.
+func (b *BandwidthCalculation) Add(n int) (updated bool) {
+
+	var now = time.Now()
+
+	if b.Start.IsZero() {
+		b.Start = now
+	}
+
+	b.Size += n
+	b.Stop = now
+	b.TimeDiff = b.Stop.Sub(b.Start).Seconds()
+
+	if b.TimeDiff < bandwidthInterval.Seconds() {
+		return false
+	}
+
+	var bitrate = float64(b.Size) * 8 / b.TimeDiff
+
+	if b.NetworkBandwidth == 0 {
+		b.NetworkBandwidth = int(bitrate)
+	} else {
+		var weight = 1 - math.Exp(-b.TimeDiff/bandwidthWindow.Seconds())
+		b.NetworkBandwidth = int(float64(b.NetworkBandwidth) + weight*(bitrate-float64(b.NetworkBandwidth)))
+	}
+
+	b.Size = 0
+	b.Start = now
+
+	return true
+}
+
+// getStreamBandwidth : Bandwidth of all active streams, sorted by the ingress bandwidth.
+// Recordings are written to the local disk and are not included in the egress bandwidth.
+func getStreamBandwidth() (streams []StreamBandwidth, ingress, egress int) {
+
+	streams = make([]StreamBandwidth, 0)
+
+	var index = make(map[string]int)
+
+	Lock.RLock()
+	BufferInformation.Range(func(_, value interface{}) bool {
+
+		var playlist = value.(*Playlist)
+
+		for streamID, stream := range playlist.Streams {
+
+			index[fmt.Sprintf("%s-%d", playlist.PlaylistID, streamID)] = len(streams)
+
+			streams = append(streams, StreamBandwidth{
+				PlaylistID:    playlist.PlaylistID,
+				Provider:      playlist.PlaylistName,
+				Channel:       stream.ChannelName,
+				Source:        stream.Source,
+				Transcode:     stream.Transcode,
+				BitrateIn:     stream.NetworkBandwidth,
+				BytesReceived: stream.BytesReceived,
+				md5:           stream.MD5,
+			})
+
+		}
+
+		return true
+	})
+	Lock.RUnlock()
+
+	streamSessions.Range(func(_, value interface{}) bool {
+
+		var session = value.(*StreamSession)
+
+		i, ok := index[fmt.Sprintf("%s-%d", session.PlaylistID, session.streamID)]
+		if !ok {
+			return true
+		}
+
+		var bitrate = session.Bandwidth()
+
+		streams[i].Clients++
+		streams[i].BitrateOut += bitrate
+		streams[i].BytesSent += atomic.LoadInt64(&session.sent)
+
+		if session.Type != "recording" {
+			egress += bitrate
+		}
+
+		return true
+	})
+
+	// Streams of the same upstream (e.g. different clients with their own stream ID) only use the upstream once
+	var upstreams = make(map[string]bool)
+
+	for _, stream := range streams {
+
+		if !upstreams[stream.PlaylistID+stream.md5] {
+			upstreams[stream.PlaylistID+stream.md5] = true
+			ingress += stream.BitrateIn
+		}
+
+	}
+
+	sort.SliceStable(streams, func(i, j int) bool {
+		return streams[i].BitrateIn > streams[j].BitrateIn
+	})
+
+	return
+}
+
+// formatBitrate : Bandwidth for the web interface (kbit/s, Mbit/s)
+func formatBitrate(bitrate int) string {
+
+	if bitrate >= 1000*1000 {
+		return fmt.Sprintf("%.1f Mbit/s", float64(bitrate)/1000/1000)
+	}
+
+	return fmt.Sprintf("%d kbit/s", bitrate/1000)
+}
@@ -1,19 +1,21 @@
 package src
 
 import (
-	"bufio"
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"os/exec"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+	"github.com/avfs/avfs"
+	"github.com/avfs/avfs/vfs/basepathfs"
 	"github.com/avfs/avfs/vfs/memfs"
+	"github.com/avfs/avfs/vfs/osfs"
 )
 
 type BackupStream struct {
@@ -28,14 +30,11 @@ type Playlist struct {
 	PlaylistID      string
 	PlaylistName    string
 	Tuner           int
-	HttpProxyIP     string
-	HttpProxyPort   string
-	HttpUserOrigin  string
-	HttpUserReferer string
+	HTTP            providerHTTP
 	Buffer          string
 
 	Clients map[int]ThisClient
-	Streams map[int]ThisStream
+	Streams map[int]*ThisStream
 }
 
 // ThisClient : Clientinfos
@@ -49,14 +48,22 @@ type ThisStream struct {
 	Error            string
 	Folder           string
 	MD5              string
-	NetworkBandwidth int
+	NetworkBandwidth int   // Ingress bandwidth of the upstream (bit/s, rolling average)
+	BytesReceived    int64 // Data that was received from the upstream
 	PlaylistID       string
 	PlaylistName     string
 	Status           bool
 	URL              string
-	BackupChannel1   *BackupStream
-	BackupChannel2   *BackupStream
-	BackupChannel3   *BackupStream
+	BackupChannels   []BackupStream
+	BufferProfile    string
+	TimeShift        int
+	Transcode        string // Transcoding profile (?transcode=), empty for the original stream
+	Warm             bool   // The upstream keeps running without clients (x-keep-warm)
+	Source           string // Source that is currently used (Primary, Backup 1, 2, ...)
+	SourceURL        string
+	Failovers        int
+	Restarts         int
+	History          []StreamEvent
 
 	Segment []Segment
 
@@ -90,10 +97,17 @@ type ThisStream struct {
 
 	DynamicStream map[int]DynamicStream
 
-        // Local temp files
-	OldSegments []string
-
 	ClientID string
+
+	// Ring buffer of the stream, it signals new data, errors and the end of the stream to the clients and the backend
+	buffer *streamBuffer
+
+	// Closed when a client returns to a lingering stream (buffer.linger.sec)
+	resume chan struct{}
+
+	// Transcoded streams: Original stream from whose buffer the transcoder reads, the transcoded stream is one of its clients
+	nativePlaylistID string
+	nativeStreamID   int
 }
 
 // Segment : URL Segments (HLS / M3U8)
@@ -124,53 +138,31 @@ type DynamicStream struct {
 	URL              string
 }
 
-// ClientConnection: Client connections
-type ClientConnection struct {
-	Connection int
-	Error      error
-}
-
 // BandwidthCalculation: Bandwidth calculation for the stream
 type BandwidthCalculation struct {
-	NetworkBandwidth int
-	Size             int
+	NetworkBandwidth int // Rolling average (bit/s)
+	Size             int // Data since the start of the current interval
 	Start            time.Time
 	Stop             time.Time
 	TimeDiff         float64
 }
 
+// getActiveClientCount : Clients of all active streams
 func getActiveClientCount() (count int) {
-	count = 0
-	cleanUpStaleClients()
 
-	BufferInformation.Range(func(key, value interface{}) bool {
-		playlist, ok := value.(Playlist)
-		if !ok {
-			fmt.Printf("Invalid type assertion for playlist: %v\n", value)
-			return true
-		}
+	Lock.RLock()
+	defer Lock.RUnlock()
 
-		for clientID, client := range playlist.Clients {
-			if client.Connection < 0 {
-				fmt.Printf("Client ID %d has negative connections: %d. Resetting to 0.\n", clientID, client.Connection)
-				client.Connection = 0
-				playlist.Clients[clientID] = client
-				BufferInformation.Store(key, playlist)
-			}
-			if client.Connection > 1 {
-				fmt.Printf("Client ID %d has suspiciously high connections: %d. Resetting to 1.\n", clientID, client.Connection)
-				client.Connection = 1
-				playlist.Clients[clientID] = client
-				BufferInformation.Store(key, playlist)
-			}
+	BufferInformation.Range(func(_, value interface{}) bool {
+
+		for _, client := range value.(*Playlist).Clients {
 			count += client.Connection
 		}
 
-		fmt.Printf("Playlist %s has %d active clients\n", playlist.PlaylistID, len(playlist.Clients))
 		return true
 	})
 
-	return count
+	return
 }
 
 func getActivePlaylistCount() (count int) {
@@ -182,25 +174,6 @@ func getActivePlaylistCount() (count int) {
 	return count
 }
 
-func cleanUpStaleClients() {
-	BufferInformation.Range(func(key, value interface{}) bool {
-		playlist, ok := value.(Playlist)
-		if !ok {
-			fmt.Printf("Invalid type assertion for playlist: %v\n", value)
-			return true
-		}
-
-		for clientID, client := range playlist.Clients {
-			if client.Connection <= 0 {
-				fmt.Printf("Removing stale client ID %d from playlist %s\n", clientID, playlist.PlaylistID)
-				delete(playlist.Clients, clientID)
-			}
-		}
-		BufferInformation.Store(key, playlist)
-		return true
-	})
-}
-
 func getClientIP(r *http.Request) string {
 	// Check the X-Forwarded-For header first
 	forwarded := r.Header.Get("X-Forwarded-For")
@@ -226,7 +199,7 @@ func getClientIP(r *http.Request) string {
 	return ip
 }
 
-func createStreamID(stream map[int]ThisStream, ip, userAgent string) (streamID int) {
+func createStreamID(stream map[int]*ThisStream, ip, userAgent string) (streamID int) {
 	streamID = 0
 	uniqueIdentifier := fmt.Sprintf("%s-%s", ip, userAgent)
 
@@ -245,973 +218,927 @@ func createStreamID(stream map[int]ThisStream, ip, userAgent string) (streamID i
 	return
 }
 
-func bufferingStream(playlistID string, streamingURL string, backupStream1 *BackupStream, backupStream2 *BackupStream, backupStream3 *BackupStream, channelName string, w http.ResponseWriter, r *http.Request) {
+// connectStream : Registers a client for the stream and starts the buffer if the stream is not yet running.
+// If no tuner is available, the backup streams are used. Returns false if none of them is available.
+func connectStream(playlistID string, streamingURL string, backupChannels []BackupStream, channelName, bufferProfile string, timeShift int, r *http.Request) (connectedPlaylistID string, streamID int, ok bool) {
 
-	time.Sleep(time.Duration(Settings.BufferTimeout) * time.Millisecond)
+	var transcode = getTranscode(r)
+	var streamMD5 = getStreamMD5(streamingURL, transcode)
+	var tunerKey = playlistID + streamMD5
+	var priority = getTunerPriority(r)
 
-	var playlist Playlist
-	var client ThisClient
-	var stream ThisStream
-	var streaming = false
-	var streamID int
-	var debug string
-	var timeOut = 0
-	var newStream = true
+	// The playlist is changed in place, all changes of the active streams are made with the lock held
+	Lock.Lock()
 
-	w.Header().Set("Connection", "close")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	var playlist *Playlist
+	if p, ok := BufferInformation.Load(playlistID); ok {
+		playlist = p.(*Playlist)
+	} else {
+		playlist = newBufferPlaylist(playlistID)
+	}
 
-	// Check whether the playlist is already in use
-	Lock.Lock()
-	if p, ok := BufferInformation.Load(playlistID); !ok {
-		Lock.Unlock() // Unlock early if not found
-		var playlistType string
+	// Check if the URL is already streaming from another client
+	for id, stream := range playlist.Streams {
 
-		// Playlist is not yet in use, create default values for the playlist
-		playlist.Folder = System.Folder.Temp + playlistID + string(os.PathSeparator)
-		playlist.PlaylistID = playlistID
-		playlist.Streams = make(map[int]ThisStream)
-		playlist.Clients = make(map[int]ThisClient)
+		// A stopped stream (e.g. preempted) keeps its ID until its clients are disconnected, it is not joined
+		if streamingURL != stream.URL || transcode != stream.Transcode || stream.buffer == nil || stream.buffer.Closed() {
+			continue
+		}
 
-		err := checkVFSFolder(playlist.Folder, bufferVFS)
-		if err != nil {
-			ShowError(err, 000)
-			httpStatusError(w, r, 404)
-			return
+		// The stream keeps its tuner, the priority of the new client is applied. If the tuner was taken over in the meantime, a new stream is started.
+		// Transcoded streams have no tuner of their own, the original stream that feeds them holds it.
+		if len(transcode) == 0 && !tuners.Acquire(playlistID, tunerKey, channelName, priority) {
+			break
 		}
 
-		switch playlist.PlaylistID[0:1] {
+		// The client continues the lingering stream without a new start of the upstream
+		if stream.resume != nil {
+			close(stream.resume)
+			stream.resume = nil
+			showInfo(fmt.Sprintf("Linger:Channel: %s - Client returned", stream.ChannelName))
+		}
 
-		case "M":
-			playlistType = "m3u"
+		var client = playlist.Clients[id]
+		client.Connection++
+		playlist.Clients[id] = client
 
-		case "H":
-			playlistType = "hdhr"
+		showDebug(fmt.Sprintf("Restream Status:Playlist: %s - Channel: %s - Connections: %d", playlist.PlaylistName, stream.ChannelName, client.Connection), 1)
+		showInfo(fmt.Sprintf("Streaming Status:Channel: %s (Clients: %d)", stream.ChannelName, client.Connection))
 
-		}
+		Lock.Unlock()
 
-		systemMutex.Lock()
-		var playListBuffer string
-		playListInterface := Settings.Files.M3U[playlistID]
-		if playListInterface == nil {
-			playListInterface = Settings.Files.HDHR[playlistID]
-		}
-                // Hard set to ffmpeg
-                playListBuffer = "ffmpeg"
-		systemMutex.Unlock()
+		return playlistID, id, true
+	}
 
-		playlist.Buffer = playListBuffer
+	// The transcoder reads the original stream, which is started or joined first
+	if len(transcode) > 0 {
+		Lock.Unlock()
+		return connectTranscodeStream(playlistID, streamingURL, transcode, backupChannels, channelName, bufferProfile, timeShift, r)
+	}
 
-		playlist.Tuner = getTuner(playlistID, playlistType)
+	// Check if a tuner is available (provider and total). A stream with a lower priority may be stopped for it.
+	if !tuners.Acquire(playlistID, tunerKey, channelName, priority) {
+		Lock.Unlock()
+		return connectBackupStream(playlist, backupChannels, channelName, bufferProfile, timeShift, r)
+	}
 
-		playlist.PlaylistName = getProviderParameter(playlist.PlaylistID, playlistType, "name")
+	// New stream, a stopped stream keeps its ID until its clients are disconnected
+	streamID = createStreamID(playlist.Streams, getClientIP(r), r.UserAgent())
 
-		playlist.HttpProxyIP = getProviderParameter(playlist.PlaylistID, playlistType, "http_proxy.ip")
-		playlist.HttpProxyPort = getProviderParameter(playlist.PlaylistID, playlistType, "http_proxy.port")
+	var stream = newBufferStream(playlist, streamingURL, transcode, backupChannels, channelName, bufferProfile, timeShift)
 
-		playlist.HttpUserOrigin = getProviderParameter(playlist.PlaylistID, playlistType, "http_headers.origin")
-		playlist.HttpUserReferer = getProviderParameter(playlist.PlaylistID, playlistType, "http_headers.referer")
+	playlist.Streams[streamID] = stream
+	playlist.Clients[streamID] = ThisClient{Connection: 1}
+	BufferInformation.Store(playlistID, playlist)
 
-		// Create default values for the stream
-		streamID = createStreamID(playlist.Streams, getClientIP(r), r.UserAgent())
+	showInfo(fmt.Sprintf("Streaming Status 1:Playlist: %s - Tuner: %d / %d", playlist.PlaylistName, len(playlist.Streams), playlist.Tuner))
 
-		client.Connection += 1
+	Lock.Unlock()
 
-		stream.URL = streamingURL
-		stream.BackupChannel1 = backupStream1
-		stream.BackupChannel2 = backupStream2
-		stream.BackupChannel3 = backupStream3
-		stream.ChannelName = channelName
-		stream.Status = false
+	go startBuffer(streamID, playlistID)
 
-		playlist.Streams[streamID] = stream
-		playlist.Clients[streamID] = client
+	return playlistID, streamID, true
+}
 
-		Lock.Lock()
-		BufferInformation.Store(playlistID, playlist)
-		Lock.Unlock()
+// newBufferStream : New stream of the playlist with its ring buffer, the buffer is started with startBuffer
+func newBufferStream(playlist *Playlist, streamingURL, transcode string, backupChannels []BackupStream, channelName, bufferProfile string, timeShift int) (stream *ThisStream) {
+
+	var streamMD5 = getStreamMD5(streamingURL, transcode)
+
+	stream = &ThisStream{
+		ChannelName:    channelName,
+		Folder:         playlist.Folder + streamMD5 + string(os.PathSeparator),
+		MD5:            streamMD5,
+		PlaylistID:     playlist.PlaylistID,
+		PlaylistName:   playlist.PlaylistName,
+		URL:            streamingURL,
+		BackupChannels: backupChannels,
+		BufferProfile:  bufferProfile,
+		TimeShift:      timeShift,
+		Transcode:      transcode,
+		buffer:         getStreamBuffer(playlist.PlaylistID + streamMD5),
+	}
 
-	} else {
-		playlist = p.(Playlist)
-		Lock.Unlock()
+	return
+}
 
-		// Playlist is already used for streaming
-		// Check if the URL is already streaming from another client.
-		for id := range playlist.Streams {
+// connectBackupStream : No tuner is available for the stream, the next backup channel is used
+func connectBackupStream(playlist *Playlist, backupChannels []BackupStream, channelName, bufferProfile string, timeShift int, r *http.Request) (connectedPlaylistID string, streamID int, ok bool) {
 
-			stream = playlist.Streams[id]
-			client = playlist.Clients[id]
+	showInfo(fmt.Sprintf("Streaming Status:Playlist: %s - No new connections available. Tuner = %d / %d", playlist.PlaylistName, playlist.Tuner, getTunerCount()))
 
-			stream.BackupChannel1 = backupStream1
-			stream.BackupChannel2 = backupStream2
-			stream.BackupChannel3 = backupStream3
-			stream.ChannelName = channelName
-			stream.Status = false
+	if len(backupChannels) > 0 {
+		return connectStream(backupChannels[0].PlaylistID, backupChannels[0].URL, backupChannels[1:], channelName, bufferProfile, timeShift, r)
+	}
 
-			if streamingURL == stream.URL {
+	return
+}
 
-				streamID = id
-				newStream = false
-				client.Connection += 1
+// newBufferPlaylist : Default values for a playlist that is not yet used for streaming
+func newBufferPlaylist(playlistID string) (playlist *Playlist) {
 
-				playlist.Clients[streamID] = client
+	var playlistType = getPlaylistType(playlistID)
 
-				Lock.Lock()
-				BufferInformation.Store(playlistID, playlist)
-				Lock.Unlock()
+	playlist = &Playlist{}
 
-				debug = fmt.Sprintf("Restream Status:Playlist: %s - Channel: %s - Connections: %d", playlist.PlaylistName, stream.ChannelName, client.Connection)
+	playlist.Folder = System.Folder.Temp + playlistID + string(os.PathSeparator)
+	playlist.PlaylistID = playlistID
+	playlist.Streams = make(map[int]*ThisStream)
+	playlist.Clients = make(map[int]ThisClient)
 
-				showDebug(debug, 1)
+	playlist.Buffer = getBufferType(playlistID, playlistType)
 
-				if c, ok := BufferClients.Load(playlistID + stream.MD5); ok {
+	playlist.Tuner = getTuner(playlistID, playlistType)
 
-					var clients = c.(ClientConnection)
-					clients.Connection = client.Connection
+	playlist.PlaylistName = getProviderParameter(playlist.PlaylistID, playlistType, "name")
 
-					showInfo(fmt.Sprintf("Streaming Status:Channel: %s (Clients: %d)", stream.ChannelName, clients.Connection))
+	playlist.HTTP = getProviderHTTP(playlist.PlaylistID, playlistType)
 
-					BufferClients.Store(playlistID+stream.MD5, clients)
+	return
+}
 
-				}
+func bufferingStream(playlistID string, streamingURL string, backupChannels []BackupStream, channelName, bufferProfile string, timeShift int, w http.ResponseWriter, r *http.Request) {
 
-				break
-			}
+	time.Sleep(time.Duration(Settings.BufferTimeout) * time.Millisecond)
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Connection", "close")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	connectedPlaylistID, streamID, ok := connectStream(playlistID, streamingURL, backupChannels, channelName, bufferProfile, timeShift, r)
+
+	// The request waits in the queue until a stream stops (e.g. a TV that tunes to the next channel)
+	if !ok && Settings.TunerQueue > 0 {
 
+		// Transcoded streams wait for the tuner of the original stream
+		var tunerKey = playlistID + getStreamMD5(streamingURL, "")
+
+		if tuners.Wait(r.Context(), playlistID, tunerKey, channelName, getTunerPriority(r), time.Duration(Settings.TunerQueue)*time.Second) {
+			connectedPlaylistID, streamID, ok = connectStream(playlistID, streamingURL, backupChannels, channelName, bufferProfile, timeShift, r)
 		}
 
-		// New stream for an already active playlist
-		if newStream {
-
-			// Check if the playlist allows another stream (Tuner)
-			if len(playlist.Streams) >= playlist.Tuner {
-				// If there are backup URLs, use them
-				if backupStream1 != nil {
-					bufferingStream(backupStream1.PlaylistID, backupStream1.URL, nil, backupStream2, backupStream3, channelName, w, r)
-				} else if backupStream2 != nil && backupStream1 == nil {
-					bufferingStream(backupStream2.PlaylistID, backupStream2.URL, nil, nil, backupStream3, channelName, w, r)
-				} else if backupStream3 != nil && backupStream1 == nil && backupStream2 == nil {
-					bufferingStream(backupStream3.PlaylistID, backupStream3.URL, nil, nil, nil, channelName, w, r)
-				}
+		if r.Context().Err() != nil {
+			if ok {
+				killClientConnection(streamID, connectedPlaylistID)
+			}
+			return
+		}
 
-				showInfo(fmt.Sprintf("Streaming Status:Playlist: %s - No new connections available. Tuner = %d", playlist.PlaylistName, playlist.Tuner))
+	}
 
-				if value, ok := webUI["html/video/stream-limit.ts"]; ok {
+	if !ok {
 
-					content := GetHTMLString(value.(string))
+		var slate = getSlate(slateTunerLimit)
+		if slate == nil {
+			return
+		}
 
-					w.WriteHeader(200)
-					w.Header().Set("Content-type", "video/mpeg")
-					w.Header().Set("Content-Length:", "0")
+		w.WriteHeader(200)
 
-					for i := 1; i < 60; i++ {
-						_ = i
-						w.Write([]byte(content))
-						time.Sleep(time.Duration(500) * time.Millisecond)
-					}
+		// The client receives the slate. With buffer.slates, a tuner is requested again until one becomes available.
+		for start := time.Now(); time.Since(start) < slateTunerLimitTimeout; {
 
-					return
-				}
+			ctx, cancel := context.WithTimeout(r.Context(), slateTunerRetryInterval)
+			err := slate.Play(ctx, w)
+			cancel()
 
+			if err != nil || r.Context().Err() != nil {
 				return
 			}
 
-			// Playlist allows another stream (Tuner limit not yet reached)
-			// Create default values for the stream
-			stream = ThisStream{}
-			client = ThisClient{}
-
-			streamID = createStreamID(playlist.Streams, getClientIP(r), r.UserAgent())
-
-			client.Connection = 1
-			stream.URL = streamingURL
-			stream.ChannelName = channelName
-			stream.Status = false
-			stream.BackupChannel1 = backupStream1
-			stream.BackupChannel2 = backupStream2
-			stream.BackupChannel3 = backupStream3
+			if !Settings.BufferSlates {
+				continue
+			}
 
-			playlist.Streams[streamID] = stream
-			playlist.Clients[streamID] = client
+			connectedPlaylistID, streamID, ok = connectStream(playlistID, streamingURL, backupChannels, channelName, bufferProfile, timeShift, r)
+			if ok {
+				showInfo(fmt.Sprintf("Slate:Channel: %s - Tuner is available", channelName))
+				break
+			}
 
-			Lock.Lock()
-			BufferInformation.Store(playlistID, playlist)
-			Lock.Unlock()
+		}
 
+		if !ok {
+			return
 		}
 
+	} else {
+		w.WriteHeader(200)
 	}
 
-	// Check whether the stream is already being played by another client
-	if !playlist.Streams[streamID].Status && newStream {
+	playlistID = connectedPlaylistID
 
-		// New buffer is needed
-		stream = playlist.Streams[streamID]
-		stream.MD5 = getMD5(streamingURL)
-		stream.Folder = playlist.Folder + stream.MD5 + string(os.PathSeparator)
-		stream.PlaylistID = playlistID
-		stream.PlaylistName = playlist.PlaylistName
-		stream.BackupChannel1 = backupStream1
-		stream.BackupChannel2 = backupStream2
-		stream.BackupChannel3 = backupStream3
+	sendStream("stream", playlistID, streamID, channelName, w, r)
+}
 
-		playlist.Streams[streamID] = stream
+// sendStream : Sends the buffer of a connected stream to the client (HTTP response or recording) until the client disconnects or the stream ends
+func sendStream(sessionType, playlistID string, streamID int, channelName string, w io.Writer, r *http.Request) {
 
-		Lock.Lock()
-		BufferInformation.Store(playlistID, playlist)
-		Lock.Unlock()
+	var debug string
+	var buffer *streamBuffer
+	var timeShift int
 
-		switch playlist.Buffer {
+	// The client is removed from the stream when it stops, the last client stops the buffer
+	defer killClientConnection(streamID, playlistID)
 
-                case "ffmpeg":
-			go thirdPartyBuffer(streamID, playlistID, false, 0)
+	// The session can be terminated through the API / web interface
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
 
-		default:
-			break
+	var session = newStreamSession(sessionType, playlistID, streamID, channelName, r, cancel)
+	defer session.Close()
 
-		}
+	Lock.RLock()
+	if p, ok := BufferInformation.Load(playlistID); ok {
 
-		showInfo(fmt.Sprintf("Streaming Status 1:Playlist: %s - Tuner: %d / %d", playlist.PlaylistName, len(playlist.Streams), playlist.Tuner))
+		if stream, ok := p.(*Playlist).Streams[streamID]; ok {
+			buffer = stream.buffer
+			timeShift = stream.TimeShift
+		}
 
-		var clients ClientConnection
-		clients.Connection = 1
-		BufferClients.Store(playlistID+stream.MD5, clients)
+	}
+	Lock.RUnlock()
 
+	if buffer == nil {
+		showDebug("Streaming Status:Stream not found. Killing Connection", 3)
+		return
 	}
 
-	w.WriteHeader(200)
+	// Wait until the first segment has been downloaded through the buffer. If all sources fail, the buffer is closed with the error.
+	if err := buffer.WaitReady(ctx); err != nil {
 
-	for { //Loop 1: Wait until the first segment has been downloaded through the buffer
+		if ctx.Err() == nil {
+			debug = fmt.Sprintf("Buffer Error: %s, killing client connection...", err.Error())
+			showDebug(debug, 2)
+		}
 
-		if p, ok := BufferInformation.Load(playlistID); ok {
+		return
+	}
 
-			var playlist = p.(Playlist)
+	var reader = buffer.NewReader(ctx)
+	defer reader.Close()
 
-			if stream, ok := playlist.Streams[streamID]; ok {
+	// Time shift: The client starts at an earlier position (?offset=-300)
+	if offset, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && offset < 0 {
+
+		if timeShift <= 0 {
+			showInfo(fmt.Sprintf("Streaming Status:Channel: %s - Time shift is not enabled, offset is ignored", channelName))
+		} else {
+			showInfo(fmt.Sprintf("Streaming Status:Channel: %s - Time shift offset: %d s", channelName, offset))
+			reader.Seek(time.Duration(offset) * time.Second)
+		}
+
+	}
 
-				if !stream.Status {
+	for { // The data is sent to the client as soon as it arrives in the buffer
 
-					timeOut++
+		data, err := reader.Read()
+		if err != nil {
 
-					time.Sleep(time.Duration(100) * time.Millisecond)
+			if ctx.Err() != nil {
+				debug = fmt.Sprintf("Buffer: ctx.done. Killing client connection...")
+			} else {
+				debug = fmt.Sprintf("Buffer Error: %s, killing client connection...", err.Error())
+			}
 
-					if c, ok := BufferClients.Load(playlistID + stream.MD5); ok {
+			showDebug(debug, 2)
+			return
+		}
 
-						var clients = c.(ClientConnection)
+		n, err := w.Write(data)
+		session.Sent(n)
 
-						if clients.Error != nil || (timeOut > 200 && (playlist.Streams[streamID].BackupChannel1 == nil && playlist.Streams[streamID].BackupChannel2 == nil && playlist.Streams[streamID].BackupChannel3 == nil)) {
-                                                        debug = fmt.Sprintf("Buffer Error: Client errpr, killing client connection...")
-                                                        showDebug(debug, 2)
-							killClientConnection(streamID, stream.PlaylistID, false)
-							return
-						}
+		if err != nil {
+			return
+		}
 
-					}
+	}
 
-					continue
-				}
+}
 
-				var oldSegments []string
+// killClientConnection : Removes a client from the stream. After the last client, the tuner is released and the buffer is closed, which stops the backend.
+func killClientConnection(streamID int, playlistID string) {
 
-				for { // Loop 2: Temporary files are present, data can be sent to the client
+	var buffer *streamBuffer
+	var channelName string
 
-					// Monitor HTTP client connection
+	Lock.Lock()
 
-					ctx := r.Context()
-					if ok {
+	if p, ok := BufferInformation.Load(playlistID); ok {
 
-						select {
+		var playlist = p.(*Playlist)
 
-						case <-ctx.Done():
-                                                        debug = fmt.Sprintf("Buffer: cts.done. Killing client connection...")
-                                                        showDebug(debug, 2)
-							killClientConnection(streamID, playlistID, false)
-							return
+		if stream, ok := playlist.Streams[streamID]; ok {
 
-						default:
-							if c, ok := BufferClients.Load(playlistID + stream.MD5); ok {
+			var client = playlist.Clients[streamID]
 
-								var clients = c.(ClientConnection)
-								if clients.Error != nil {
-                                                                        debug = fmt.Sprintf("Buffer Error: Client Error, killing client connection...")
-                                                                        showDebug(debug, 2)
-									ShowError(clients.Error, 0)
-									killClientConnection(streamID, playlistID, false)
-									return
-								}
+			client.Connection--
+			if client.Connection < 0 {
+				client.Connection = 0
+			}
 
-							} else {
+			playlist.Clients[streamID] = client
 
-								return
+			showInfo(fmt.Sprintf("Streaming Status: Channel: %s (Clients: %d)", stream.ChannelName, client.Connection))
 
-							}
+			// A warm stream keeps running without clients, every request can take over its tuner
+			if client.Connection == 0 && stream.Warm && stream.buffer != nil && !stream.buffer.Closed() {
 
-						}
+				tuners.Standby(playlistID + stream.MD5)
+				showInfo(fmt.Sprintf("Keep Warm:Channel: %s - The upstream keeps running without clients", stream.ChannelName))
 
-					}
+			} else if client.Connection == 0 && Settings.BufferLinger > 0 && stream.buffer != nil && !stream.buffer.Closed() {
 
-					if _, err := bufferVFS.Stat(stream.Folder); fsIsNotExistErr(err) {
-                                                debug = fmt.Sprintf("Buffer Error: fsIsNotExistErr, killing client connection...")
-                                                showDebug(debug, 2)
-						killClientConnection(streamID, playlistID, false)
-						return
-					}
+				// The upstream keeps running for the linger time, a client that reconnects continues immediately
+				tuners.Standby(playlistID + stream.MD5)
 
-					var tmpFiles = getBufTmpFiles(&stream)
+				stream.resume = make(chan struct{})
+				go lingerStream(playlistID, streamID, stream, stream.resume)
 
-					for _, f := range tmpFiles {
+				showInfo(fmt.Sprintf("Linger:Channel: %s - The upstream keeps running for %d seconds", stream.ChannelName, Settings.BufferLinger))
 
-						if _, err := bufferVFS.Stat(stream.Folder); fsIsNotExistErr(err) {
-                                                        debug = fmt.Sprintf("Buffer Error: fsIsNotExistErr, killing client connection...")
-                                                        showDebug(debug, 2)
-							killClientConnection(streamID, playlistID, false)
-							return
-						}
+			} else if client.Connection == 0 {
 
-						oldSegments = append(oldSegments, f)
+				buffer = stream.buffer
+				channelName = stream.ChannelName
 
-						var fileName = stream.Folder + f
+				deleteStream(playlist, streamID)
 
-						file, err := bufferVFS.Open(fileName)
-						if err != nil {
-							debug = fmt.Sprintf("Buffer Open (%s)", fileName)
-							showDebug(debug, 2)
-							return
-						}
-						defer file.Close()
+			}
 
-						if err == nil {
+			showInfo(fmt.Sprintf("Streaming Status: Playlist: %s - Tuner: %d / %d", playlist.PlaylistName, len(playlist.Streams), playlist.Tuner))
 
-							l, err := file.Stat()
-							if err == nil {
+		}
 
-								debug = fmt.Sprintf("Buffer Status:Send to client (%s)", fileName)
-								showDebug(debug, 2)
+	}
 
-								var buffer = make([]byte, int(l.Size()))
-								_, err = file.Read(buffer)
+	Lock.Unlock()
 
-								if err == nil {
+	if buffer != nil {
 
-									file.Seek(0, 0)
+		showDebug(fmt.Sprintf("Streaming Status:Remove buffer (%s)", channelName), 1)
+		showInfo(fmt.Sprintf("Streaming Status:Channel: %s - No client is using this channel anymore. Streaming Server connection has ended", channelName))
 
-									if !streaming {
+		buffer.Close(nil)
 
-										contentType := http.DetectContentType(buffer)
-										_ = contentType
-										w.Header().Set("Content-type", contentType)
-										w.Header().Set("Content-Length", "0")
-										w.Header().Set("Connection", "close")
+	}
 
-									}
-									_, err := w.Write(buffer)
+}
 
-									if err != nil {
-										file.Close()
-										killClientConnection(streamID, playlistID, false)
-										return
-									}
+// lingerStream : Stops a stream without clients after the linger time, unless a client returns. A stream whose buffer is closed is removed immediately.
+func lingerStream(playlistID string, streamID int, stream *ThisStream, resume chan struct{}) {
 
-									file.Close()
-									streaming = true
+	var timer = time.NewTimer(time.Duration(Settings.BufferLinger) * time.Second)
+	defer timer.Stop()
 
-								}
+	select {
 
-								file.Close()
+	case <-resume:
+		return
 
-							}
+	case <-timer.C:
 
-							var n = indexOfString(f, oldSegments)
+	case <-stream.buffer.Done():
 
-							if n > 20 {
+	}
 
-								var fileToRemove = stream.Folder + oldSegments[0]
-								if err = bufferVFS.RemoveAll(getPlatformFile(fileToRemove)); err != nil {
-									ShowError(err, 4007)
-								}
-								oldSegments = append(oldSegments[:0], oldSegments[0+1:]...)
+	if buffer := removeIdleStream(playlistID, streamID, stream); buffer != nil {
 
-							}
+		if !buffer.Closed() {
+			showInfo(fmt.Sprintf("Linger:Channel: %s - No client returned, the upstream is stopped", stream.ChannelName))
+		}
 
-						}
+		buffer.Close(nil)
 
-						file.Close()
+	}
 
-					}
+}
 
-					if len(tmpFiles) == 0 {
-						time.Sleep(time.Duration(100) * time.Millisecond)
-					}
+// removeIdleStream : Removes a stream that has no clients. Warm streams are only removed when their buffer is closed.
+// Returns the buffer of the removed stream, nil if the stream is still in use.
+func removeIdleStream(playlistID string, streamID int, stream *ThisStream) (buffer *streamBuffer) {
 
-				} // End Loop 2
+	Lock.Lock()
+	defer Lock.Unlock()
 
-			} else {
+	p, ok := BufferInformation.Load(playlistID)
+	if !ok {
+		return
+	}
 
-				// Stream not found
-				showDebug("Streaming Status:Stream not found. Killing Connection", 3)
-				killClientConnection(streamID, stream.PlaylistID, false)
-				showInfo(fmt.Sprintf("Streaming Status:Playlist: %s - Tuner: %d / %d", playlist.PlaylistName, len(playlist.Streams), playlist.Tuner))
-				return
+	var playlist = p.(*Playlist)
 
-			}
+	if s, ok := playlist.Streams[streamID]; !ok || s != stream || playlist.Clients[streamID].Connection > 0 {
+		return
+	}
 
-		} // End BufferInformation
+	if stream.Warm && !stream.buffer.Closed() {
+		return
+	}
 
-	} // End Loop 1
+	deleteStream(playlist, streamID)
 
+	return stream.buffer
 }
 
-func getBufTmpFiles(stream *ThisStream) (tmpFiles []string) {
+// deleteStream : Removes the stream from the playlist and releases its tuner, must be called with the lock held.
+// A stopped stream does not release the tuner of a new stream of the same channel.
+func deleteStream(playlist *Playlist, streamID int) {
 
-	var tmpFolder = stream.Folder
-	var fileIDs []float64
+	var stream, ok = playlist.Streams[streamID]
 
-	if _, err := bufferVFS.Stat(tmpFolder); !fsIsNotExistErr(err) {
+	delete(playlist.Streams, streamID)
+	delete(playlist.Clients, streamID)
 
-		files, err := bufferVFS.ReadDir(getPlatformPath(tmpFolder))
-		if err != nil {
-			ShowError(err, 000)
-			return
+	if ok {
+
+		var running bool
+		for _, s := range playlist.Streams {
+			if s.MD5 == stream.MD5 {
+				running = true
+			}
 		}
 
-		if len(files) > 2 {
+		if !running {
+			tuners.Release(playlist.PlaylistID + stream.MD5)
+		}
 
-			for _, file := range files {
+		// A transcoded stream was a client of the original stream, the lock is held
+		if len(stream.nativePlaylistID) > 0 {
+			go killClientConnection(stream.nativeStreamID, stream.nativePlaylistID)
+		}
 
-				var fileID = strings.Replace(file.Name(), ".ts", "", -1)
-				var f, err = strconv.ParseFloat(fileID, 64)
+	}
 
-				if err == nil {
-					fileIDs = append(fileIDs, f)
-				}
+	if len(playlist.Streams) == 0 {
+		BufferInformation.Delete(playlist.PlaylistID)
+	}
 
-			}
+}
 
-			sort.Float64s(fileIDs)
-			fileIDs = fileIDs[:len(fileIDs)-1]
+// switchBandwidth : Variant of an HLS stream with the highest bandwidth up to the limit (bit/s). Without a limit or if every variant exceeds it, the lowest bandwidth is used.
+func switchBandwidth(variants map[int]DynamicStream, limit int) (variant DynamicStream, err error) {
 
-			for _, file := range fileIDs {
+	var bandwidth []int
 
-				var fileName = fmt.Sprintf("%d.ts", int64(file))
+	for key := range variants {
+		bandwidth = append(bandwidth, key)
+	}
 
-				if indexOfString(fileName, stream.OldSegments) == -1 {
-					tmpFiles = append(tmpFiles, fileName)
-					stream.OldSegments = append(stream.OldSegments, fileName)
-				}
+	sort.Ints(bandwidth)
 
-			}
+	if len(bandwidth) == 0 {
+		err = errors.New("M3U8 does not contain streaming URLs")
+		return
+	}
+
+	variant = variants[bandwidth[0]]
 
+	if limit <= 0 {
+		return
+	}
+
+	for _, key := range bandwidth {
+
+		if key > limit {
+			break
 		}
 
+		variant = variants[key]
+
 	}
 
 	return
 }
 
-func killClientConnection(streamID int, playlistID string, force bool) {
-	Lock.Lock()
-	defer Lock.Unlock()
+// Buffer with the backend of the playlist (FFmpeg or native).
+// If the source fails, the stream continues with the next backup channel without disconnecting the clients.
+func startBuffer(streamID int, playlistID string) {
 
+	var stream ThisStream
+	var sources []bufferSource
+
+	// The buffer works with a copy of the stream information, changes are made through updateStream
+	Lock.RLock()
 	if p, ok := BufferInformation.Load(playlistID); ok {
-		var playlist = p.(Playlist)
 
-		if force {
-			delete(playlist.Streams, streamID)
-			if len(playlist.Streams) == 0 {
-				BufferInformation.Delete(playlistID)
-			} else {
-				BufferInformation.Store(playlistID, playlist)
-			}
-			showInfo(fmt.Sprintf("Streaming Status: Playlist: %s - Tuner: %d / %d", playlist.PlaylistName, len(playlist.Streams), playlist.Tuner))
-			return
+		var playlist = p.(*Playlist)
+
+		if s, ok := playlist.Streams[streamID]; ok {
+			stream = *s
+			sources = getBufferSources(*playlist, stream)
 		}
 
-		if stream, ok := playlist.Streams[streamID]; ok {
-			client := playlist.Clients[streamID]
+	}
+	Lock.RUnlock()
 
-			if c, ok := BufferClients.Load(playlistID + stream.MD5); ok {
-				var clients = c.(ClientConnection)
-				clients.Connection--
-				client.Connection--
+	if stream.buffer == nil {
+		return
+	}
 
-				// Ensure client connections cannot go below zero
-				if client.Connection < 0 {
-					client.Connection = 0
-				}
-				if clients.Connection < 0 {
-					clients.Connection = 0
-				}
+	var buffer = stream.buffer
+	buffer.SetTimeShift(time.Duration(stream.TimeShift) * time.Minute)
+
+	var profile = getBufferProfile(stream.BufferProfile)
+	if len(stream.BufferProfile) > 0 {
+		showInfo("Buffer Profile:" + stream.BufferProfile)
+	}
 
-				playlist.Clients[streamID] = client
-				BufferClients.Store(playlistID+stream.MD5, clients)
+	var writer = newTSWriter(buffer)
+	defer writer.StopSlate()
 
-				showInfo(fmt.Sprintf("Streaming Status: Channel: %s (Clients: %d)", stream.ChannelName, clients.Connection))
+	// Transcoding (?transcode=): FFmpeg reads the buffer of the original stream, the stream has no upstream of its own
+	if len(stream.Transcode) > 0 {
+		transcodeBuffer(streamID, stream, writer)
+		return
+	}
 
-				if clients.Connection <= 0 {
-					BufferClients.Delete(playlistID + stream.MD5)
-					delete(playlist.Streams, streamID)
-					delete(playlist.Clients, streamID)
+	var failback = newStreamFailback(sources[0], profile, stream)
+	defer failback.Stop()
 
-					if len(playlist.Streams) == 0 {
-						BufferInformation.Delete(playlistID)
-					} else {
-						BufferInformation.Store(playlistID, playlist)
-					}
-				} else {
-					BufferInformation.Store(playlistID, playlist)
-				}
+	var source = 0
+	var restarts = 0 // Restarts of the current source, after streamRestartLimit the next source is used
+	var backend BufferBackend
+	var err error
 
-				if len(playlist.Streams) > 0 {
-					showInfo(fmt.Sprintf("Streaming Status: Playlist: %s - Tuner: %d / %d", playlist.PlaylistName, len(playlist.Streams), playlist.Tuner))
-				}
-			}
+	// Backup channels of other providers use a tuner of their provider, it is released when the source is no longer used
+	var sourceTuner string
+	var releaseSourceTuner = func() {
+		if len(sourceTuner) > 0 {
+			tuners.Release(sourceTuner)
+			sourceTuner = ""
 		}
 	}
-}
+	defer func() { releaseSourceTuner() }()
 
-func clientConnection(stream ThisStream) (status bool) {
-
-	status = true
-	Lock.Lock()
-	defer Lock.Unlock()
+	updateStream(playlistID, streamID, func(s *ThisStream) {
+		s.Source = sources[source].Name
+		s.SourceURL = sources[source].URL
+	})
 
-	if _, ok := BufferClients.Load(stream.PlaylistID + stream.MD5); !ok {
+	for {
 
-		var debug = fmt.Sprintf("Streaming Status:Remove temporary files (%s)", stream.Folder)
-		showDebug(debug, 1)
+		if backend == nil {
 
-		status = false
+			err = nil
 
-		debug = fmt.Sprintf("Remove tmp folder:%s", stream.Folder)
-		showDebug(debug, 1)
+			if key := getSourceTunerKey(sources[source], stream); key != sourceTuner {
 
-		if err := bufferVFS.RemoveAll(stream.Folder); err != nil {
-			ShowError(err, 4005)
-		}
+				releaseSourceTuner()
 
-		if p, ok := BufferInformation.Load(stream.PlaylistID); !ok {
+				if len(key) > 0 {
 
-			showInfo(fmt.Sprintf("Streaming Status:Channel: %s - No client is using this channel anymore. Streaming Server connection has ended", stream.ChannelName))
+					if tuners.AcquireSource(sources[source].Playlist.PlaylistID, key, playlistID+stream.MD5, stream.ChannelName) {
+						sourceTuner = key
+					} else {
+						err = fmt.Errorf("%s: %w", sources[source].Name, errNoSourceTuner)
+					}
 
-			if p != nil {
-				var playlist = p.(Playlist)
+				}
 
-				showInfo(fmt.Sprintf("Streaming Status:Playlist: %s - Tuner: %d / %d", playlist.PlaylistName, len(playlist.Streams), playlist.Tuner))
+			}
 
-				if len(playlist.Streams) <= 0 {
-					BufferInformation.Delete(stream.PlaylistID)
-				}
+			if err == nil {
+				backend, err = startBufferSource(sources[source], profile)
 			}
 
 		}
 
-		status = false
-
-	}
+		if err == nil {
 
-	return
-}
+			var next BufferBackend
+			next, err = pumpBuffer(streamID, stream, sources[source], backend, writer, profile, failback)
+			backend.Stop()
 
-func switchBandwidth(stream *ThisStream) (err error) {
+			// No more clients
+			if err == nil && next == nil {
+				return
+			}
 
-	var bandwidth []int
-	var dynamicStream DynamicStream
-	var segment Segment
+			// The primary source is available again
+			if next != nil {
 
-	for key := range stream.DynamicStream {
-		bandwidth = append(bandwidth, key)
-	}
+				showHighlight(fmt.Sprintf("FAILBACK: %s", stream.ChannelName))
+				showInfo(fmt.Sprintf("Failback:Channel: %s - %s -> %s", stream.ChannelName, sources[source].Name, sources[0].Name))
 
-	sort.Ints(bandwidth)
+				source = 0
+				restarts = 0
+				backend = next
+				releaseSourceTuner()
+				failback.Reset()
 
-	if len(bandwidth) > 0 {
+				updateStream(playlistID, streamID, func(s *ThisStream) {
+					s.Source = sources[source].Name
+					s.SourceURL = sources[source].URL
+					s.addEvent("Failback to " + sources[source].Name)
+				})
 
-		for i := range bandwidth {
+				buffer.Discontinuity()
+				writer.Reset()
+				continue
+			}
 
-			segment.StreamInf.Bandwidth = stream.DynamicStream[bandwidth[i]].Bandwidth
+			// The upstream stopped delivering data, it is restarted. If it does not deliver data again, the next source is used.
+			if errors.Is(err, errStreamStalled) && restarts < streamRestartLimit {
 
-			dynamicStream = stream.DynamicStream[bandwidth[0]]
+				restarts++
 
-			if stream.NetworkBandwidth == 0 {
+				updateStream(playlistID, streamID, func(s *ThisStream) {
+					s.Restarts++
+					s.addEvent("Restart of " + sources[source].Name + " (stalled)")
+				})
 
-				dynamicStream = stream.DynamicStream[bandwidth[0]]
-				break
+				showInfo(fmt.Sprintf("Stall:Channel: %s - No data for %d seconds, restarting %s (%d / %d)", stream.ChannelName, profile.StallTimeout, sources[source].Name, restarts, streamRestartLimit))
 
-			} else {
+				backend = nil
+				buffer.Discontinuity()
+				writer.Reset()
 
-				if bandwidth[i] > stream.NetworkBandwidth {
-					break
+				// The clients stay connected and receive the slate until the upstream delivers data again
+				if buffer.Ready() {
+					writer.PlaySlate(slateReconnecting)
 				}
 
-				dynamicStream = stream.DynamicStream[bandwidth[i]]
-
+				continue
 			}
 
 		}
 
-	} else {
-
-		err = errors.New("M3U8 does not contain streaming URLs")
-		return
-
-	}
-
-	segment.URL = dynamicStream.URL
-	segment.Duration = 0
-	stream.Segment = append(stream.Segment, segment)
-
-	return
-}
+		backend = nil
 
-// Buffer with FFMPEG
-func thirdPartyBuffer(streamID int, playlistID string, useBackup bool, backupNumber int) {
+		if errors.Is(err, errBufferClosed) {
+			return
+		}
 
-	if p, ok := BufferInformation.Load(playlistID); ok {
+		ShowError(err, 1204)
 
-		var playlist = p.(Playlist)
-		var debug, path, options, bufferType string
-		var tmpSegment = 1
-		var bufferSize = Settings.BufferSize * 1024
-		var stream = playlist.Streams[streamID]
-		var buf bytes.Buffer
-		var fileSize = 0
-		var streamStatus = make(chan bool)
-
-		var tmpFolder = playlist.Streams[streamID].Folder
-		var url = playlist.Streams[streamID].URL
-                debug = fmt.Sprintf("Buffer FFMpeg Starting: " + url)
-                showDebug(debug, 2)
-
-		if useBackup {
-			if backupNumber >= 1 && backupNumber <= 3 {
-				switch backupNumber {
-				case 1:
-					url = stream.BackupChannel1.URL
-					showHighlight("START OF BACKUP 1 STREAM")
-					showInfo("Backup Channel 1 URL: " + url)
-				case 2:
-					url = stream.BackupChannel2.URL
-					showHighlight("START OF BACKUP 2 STREAM")
-					showInfo("Backup Channel 2 URL: " + url)
-				case 3:
-					url = stream.BackupChannel3.URL
-					showHighlight("START OF BACKUP 3 STREAM")
-					showInfo("Backup Channel 3 URL: " + url)
-				}
-			}
+		// Without a tuner of its provider, the backup channel was not started
+		if !errors.Is(err, errNoSourceTuner) {
+			setUpstreamStatus(sources[source].URL, err)
 		}
 
-		stream.Status = false
+		if source+1 >= len(sources) {
 
-		bufferType = strings.ToUpper(playlist.Buffer)
+			// A warm stream without clients does not keep its tuner for a failed upstream
+			if stream.Warm && getStreamConnections(playlistID, streamID) == 0 {
+				buffer.Close(err)
+				return
+			}
 
-		switch playlist.Buffer {
+			// Running streams show that the upstream failed, streams that never started that the channel is offline
+			var name = slateChannelOffline
+			if buffer.Ready() {
+				name = slateUpstreamFailure
+			}
 
-		case "ffmpeg":
+			writer.PlaySlate(name)
 
-                        //hard coding path to python yt-dlp wrapper script for ffmpeg
-                        path = "/home/threadfin/bin/wrapper"
-			options = Settings.FFmpegOptions
+			if writer.slate == nil {
 
-		default:
-			return
-		}
+				debug := fmt.Sprintf("Buffer Error: No more sources for %s, stopping buffer", stream.ChannelName)
+				showDebug(debug, 2)
 
-		var addErrorToStream = func(err error) {
-			if !useBackup || (useBackup && backupNumber >= 0 && backupNumber <= 3) {
-				backupNumber = backupNumber + 1
-				if stream.BackupChannel1 != nil || stream.BackupChannel2 != nil || stream.BackupChannel3 != nil {
-					thirdPartyBuffer(streamID, playlistID, true, backupNumber)
-				}
+				// The clients receive the error and disconnect
+				buffer.Close(err)
 				return
 			}
 
-			var stream = playlist.Streams[streamID]
+			showInfo(fmt.Sprintf("Slate:Channel: %s - No more sources, next attempt in %d seconds", stream.ChannelName, int(slateRetryInterval.Seconds())))
+
+			// The clients stay connected with the slate, all sources are tried again
+			releaseSourceTuner()
 
-			if c, ok := BufferClients.Load(playlistID + stream.MD5); ok {
+			select {
+
+			case <-buffer.Done():
+				return
 
-				var clients = c.(ClientConnection)
-				clients.Error = err
-				BufferClients.Store(playlistID+stream.MD5, clients)
+			case <-time.After(slateRetryInterval):
 
 			}
 
-		}
+			source = 0
+			restarts = 0
+			failback.Reset()
 
-		if err := bufferVFS.RemoveAll(getPlatformPath(tmpFolder)); err != nil {
-			ShowError(err, 4005)
-		}
+			updateStream(playlistID, streamID, func(s *ThisStream) {
+				s.Source = sources[source].Name
+				s.SourceURL = sources[source].URL
+				s.addEvent("Retry of " + sources[source].Name)
+			})
 
-		err := checkVFSFolder(tmpFolder, bufferVFS)
-		if err != nil {
-			ShowError(err, 0)
-                        debug = fmt.Sprintf("Buffer Error: checkVFSFolder")
-                        showDebug(debug, 2)
-			killClientConnection(streamID, playlistID, false)
-			addErrorToStream(err)
-			return
+			continue
 		}
 
-		err = checkFile(path)
-		if err != nil {
-			ShowError(err, 0)
-                        debug = fmt.Sprintf("Buffer Error: checkFile")
-                        showDebug(debug, 2)
-			killClientConnection(streamID, playlistID, false)
-			addErrorToStream(err)
+		// No more clients
+		if buffer.Closed() {
 			return
 		}
 
-		showInfo(fmt.Sprintf("%s path:%s", bufferType, path))
-		showInfo("Streaming URL:" + url)
+		var failovers int
+		updateStream(playlistID, streamID, func(s *ThisStream) {
+			s.Source = sources[source+1].Name
+			s.SourceURL = sources[source+1].URL
+			s.Failovers++
+			s.addEvent("Failover to " + sources[source+1].Name)
+			failovers = s.Failovers
+		})
 
-		var tmpFile = fmt.Sprintf("%s%d.ts", tmpFolder, tmpSegment)
+		showHighlight(fmt.Sprintf("FAILOVER: %s", stream.ChannelName))
+		showInfo(fmt.Sprintf("Failover:Channel: %s - %s -> %s (Failovers: %d)", stream.ChannelName, sources[source].Name, sources[source+1].Name, failovers))
 
-		f, err := bufferVFS.Create(tmpFile)
-		f.Close()
-		if err != nil {
-			ShowError(err, 0)
-                        debug = fmt.Sprintf("Buffer Error: bufferVFS.Create")
-                        showDebug(debug, 2)
-			killClientConnection(streamID, playlistID, false)
-			addErrorToStream(err)
-			return
+		source++
+		restarts = 0
+
+		// Clients stay connected, the new source continues in a new segment
+		buffer.Discontinuity()
+		writer.Reset()
+		failback.Schedule(sources[source])
+
+		if buffer.Ready() {
+			writer.PlaySlate(slateReconnecting)
 		}
 
-		// Set User-Agent
-		var args []string
+	}
 
-		for i, a := range strings.Split(options, " ") {
+}
 
-			switch bufferType {
-			case "FFMPEG":
-				a = strings.Replace(a, "[URL]", url, -1)
-				if i == 0 {
-					if len(Settings.UserAgent) != 0 {
-						args = []string{"-user_agent", Settings.UserAgent}
-					}
+// Restarts of a stalled source before the next source is used
+const streamRestartLimit = 3
 
-					if playlist.HttpProxyIP != "" && playlist.HttpProxyPort != "" {
-						args = append(args, "-http_proxy", fmt.Sprintf("http://%s:%s", playlist.HttpProxyIP, playlist.HttpProxyPort))
-					}
+// errNoSourceTuner : The provider of a backup channel has no free tuner
+var errNoSourceTuner = errors.New("No tuner of the provider is available")
 
-					var headers string
-					if len(playlist.HttpUserReferer) != 0 {
-						headers += fmt.Sprintf("Referer: %s\r\n", playlist.HttpUserReferer)
-					}
-					if len(playlist.HttpUserOrigin) != 0 {
-						headers += fmt.Sprintf("Origin: %s\r\n", playlist.HttpUserOrigin)
-					}
-					if headers != "" {
-						args = append(args, "-headers", headers)
-					}
-				}
+// errStreamStalled : The upstream of a running stream has not delivered new data within the stall timeout
+var errStreamStalled = errors.New("Stream stalled")
 
-				args = append(args, a)
+// pumpBuffer : Writes the data of the backend into the buffer. Returns when the backend fails (error),
+// no client is connected anymore (nil), the upstream stalls (errStreamStalled) or the primary source is available again (next backend).
+func pumpBuffer(streamID int, stream ThisStream, source bufferSource, backend BufferBackend, writer *tsWriter, profile BufferProfile, failback *streamFailback) (next BufferBackend, err error) {
 
-			}
+	var debug string
+	var bufferType = strings.ToUpper(source.Playlist.Buffer)
+	var buffer = writer.buffer
 
-		}
+	showInfo(bufferType + ":Processing data")
 
-		var cmd = exec.Command(path, args...)
-		// Set this explicitly to avoid issues with VLC
-		cmd.Env = append(os.Environ(), "DISPLAY=:0")
+	// The first source has to deliver the first segment within the startup timeout of the profile, a backup channel the first data
+	// The timers run in their own goroutine, they do not share the debug message of the loop
+	var timeout = time.AfterFunc(time.Duration(profile.StartupTimeout)*time.Second, func() {
+		showDebug(fmt.Sprintf("Buffer Error: Timeout! Stopping %s backend!", bufferType), 2)
+		ShowError(errors.New("Timeout"), 4006)
+		backend.Stop()
+	})
+	defer timeout.Stop()
 
-		debug = fmt.Sprintf("BUFFER DEBUG: %s:%s %s", bufferType, path, args)
-		showDebug(debug, 1)
+	// As soon as the stream is running, the upstream has to deliver new data within the stall timeout of the profile
+	var stallTimeout = time.Duration(profile.StallTimeout) * time.Second
+	var stall *time.Timer
+	var stalled atomic.Bool
 
-		// Byte data from the process
-		stdOut, err := cmd.StdoutPipe()
-		if err != nil {
-			ShowError(err, 0)
-                        debug = fmt.Sprintf("Buffer Error: cmd.StdoutPipe, killing client connection...")
-                        showDebug(debug, 2)
-			killClientConnection(streamID, playlistID, false)
-			addErrorToStream(err)
-			return
+	defer func() {
+		if stall != nil {
+			stall.Stop()
 		}
+	}()
 
-		// Log data from the process
-		logOut, err := cmd.StderrPipe()
-		if err != nil {
-			ShowError(err, 0)
-                        debug = fmt.Sprintf("Buffer Error: cmd.StderrPipe, killing client connection...")
-                        showDebug(debug, 2)
-			killClientConnection(streamID, playlistID, false)
-			addErrorToStream(err)
-			return
-		}
+	// The buffer is closed as soon as the last client is gone, the backend is stopped without waiting for the next data
+	var finished = make(chan struct{})
+	defer close(finished)
 
-		if len(buf.Bytes()) == 0 && !stream.Status {
-			showInfo(bufferType + ":Processing data")
-		}
+	go func() {
 
-		cmd.Start()
-		defer cmd.Wait()
+		select {
 
-		go func() {
+		case <-buffer.Done():
+			backend.Stop()
 
-			// Display log data from the process in debug mode 1.
-			scanner := bufio.NewScanner(logOut)
-			scanner.Split(bufio.ScanLines)
+		case <-finished:
 
-			for scanner.Scan() {
+		}
 
-				debug = fmt.Sprintf("%s log:%s", bufferType, strings.TrimSpace(scanner.Text()))
+	}()
 
-				select {
-				case <-streamStatus:
-					showDebug(debug, 1)
-				default:
-					showInfo(debug)
-				}
+	var started bool
+	var report = time.Now()
+	var data = make([]byte, 1024*4)
 
-				time.Sleep(time.Duration(10) * time.Millisecond)
+	showInfo("Streaming Status:Receive data from " + bufferType)
 
-			}
+	for {
 
-		}()
+		select {
+
+		case next = <-failback.Ready():
+			return
+
+		default:
 
-		f, err = bufferVFS.OpenFile(tmpFile, os.O_APPEND|os.O_WRONLY, 0600)
-		if err != nil {
-			panic(err)
 		}
-		defer f.Close()
 
-		buffer := make([]byte, 1024*4)
+		n, readErr := backend.Read(data)
 
-		reader := bufio.NewReader(stdOut)
+		if n > 0 {
 
-		t := make(chan int)
+			if stall != nil {
+				stall.Reset(stallTimeout)
+			}
+
+			if _, err = writer.Write(data[:n]); err != nil {
+				debug = fmt.Sprintf("Buffer Write Error: Stopping %s backend!", bufferType)
+				showDebug(debug, 2)
+				return
+			}
 
-		go func() {
+			// The buffer measures the ingress bandwidth, the stream information is updated once per interval
+			if time.Since(report) >= bandwidthInterval {
 
-			var timeout = 0
-			for {
-				time.Sleep(time.Duration(1000) * time.Millisecond)
-				timeout++
+				report = time.Now()
+				var bitrate, received = buffer.Bandwidth()
 
-				select {
-				case <-t:
-					return
-				default:
-					// Check if the channel is closed before sending
-					select {
-					case t <- timeout:
-					default:
-					}
-				}
+				updateStream(stream.PlaylistID, streamID, func(s *ThisStream) {
+					s.NetworkBandwidth = bitrate
+					s.BytesReceived = received
+				})
 
 			}
 
-		}()
+			if !started && buffer.Ready() {
 
-		for {
+				started = true
+				timeout.Stop()
 
-			select {
-			case timeout := <-t:
-				if timeout >= 20 && tmpSegment == 1 {
-                                        debug = fmt.Sprintf("Buffer Error: Timeout! Killing ffmpeg process!")
-                                        showDebug(debug, 2)
-					cmd.Process.Kill()
-					err = errors.New("Timeout")
-					ShowError(err, 4006)
-					killClientConnection(streamID, playlistID, false)
-					addErrorToStream(err)
-					cmd.Wait()
-					f.Close()
-					return
-				}
+				stallTimeout = getStallTimeout(backend, stallTimeout)
 
-			default:
+				stall = time.AfterFunc(stallTimeout, func() {
+					showDebug(fmt.Sprintf("Buffer Error: No data for %d seconds! Stopping %s backend!", int(stallTimeout.Seconds()), bufferType), 2)
+					stalled.Store(true)
+					backend.Stop()
+				})
+				showInfo(fmt.Sprintf("Streaming Status:Buffering data from %s", bufferType))
+				setUpstreamStatus(source.URL, nil)
 
-			}
+				updateStream(stream.PlaylistID, streamID, func(s *ThisStream) {
+					s.Status = true
+				})
 
-			if fileSize == 0 && !stream.Status {
-				showInfo("Streaming Status:Receive data from " + bufferType)
 			}
 
-			if !clientConnection(stream) {
-                                debug = fmt.Sprintf("Buffer Error: No clients for stream. Killing ffmpeg!")
-                                showDebug(debug, 2)
-				cmd.Process.Kill()
-				f.Close()
-				cmd.Wait()
-				return
-			}
+		}
 
-			n, err := reader.Read(buffer)
-			if err == io.EOF {
-				break
+		if readErr != nil {
+
+			if buffer.Closed() {
+				debug = fmt.Sprintf("Buffer Error: No clients for stream. Stopping %s backend!", bufferType)
+				showDebug(debug, 2)
+				return nil, nil
 			}
 
-			fileSize = fileSize + len(buffer[:n])
+			debug = fmt.Sprintf("Stopping %s backend...", bufferType)
+			showDebug(debug, 2)
 
-			if _, err := f.Write(buffer[:n]); err != nil {
-                                debug = fmt.Sprintf("Buffer Write Error: Killing ffmpeg!")
-                                showDebug(debug, 2)
-				cmd.Process.Kill()
-				ShowError(err, 0)
-				killClientConnection(streamID, playlistID, false)
-				addErrorToStream(err)
-				cmd.Wait()
+			if stalled.Load() {
+				err = errStreamStalled
 				return
 			}
 
-			if fileSize >= bufferSize/2 {
+			err = backend.Error()
+			if err == nil {
+				err = errors.New(bufferType + " error")
+			}
 
-				if tmpSegment == 1 && !stream.Status {
-					close(t)
-					close(streamStatus)
-					showInfo(fmt.Sprintf("Streaming Status:Buffering data from %s", bufferType))
-				}
+			return
+		}
 
-				f.Close()
-				tmpSegment++
+	}
 
-				if !stream.Status {
-					Lock.Lock()
-					stream.Status = true
-					playlist.Streams[streamID] = stream
-					BufferInformation.Store(playlistID, playlist)
-					Lock.Unlock()
-				}
+}
 
-				tmpFile = fmt.Sprintf("%s%d.ts", tmpFolder, tmpSegment)
-
-				fileSize = 0
-
-				var errCreate, errOpen error
-				_, errCreate = bufferVFS.Create(tmpFile)
-				f, errOpen = bufferVFS.OpenFile(tmpFile, os.O_APPEND|os.O_WRONLY, 0600)
-				if errCreate != nil || errOpen != nil {
-                                        debug = fmt.Sprintf("Buffer Error: Failed to create file. Killing ffmpeg!")
-                                        showDebug(debug, 2)
-					cmd.Process.Kill()
-					ShowError(err, 0)
-					killClientConnection(streamID, playlistID, false)
-					addErrorToStream(err)
-					cmd.Wait()
-					return
-				}
+// getStallTimeout : Stall timeout of the backend, at least the timeout of the profile. HLS streams need more time between their segments.
+func getStallTimeout(backend BufferBackend, timeout time.Duration) time.Duration {
 
-			}
+	if failback, ok := backend.(*failbackBackend); ok {
+		backend = failback.BufferBackend
+	}
 
-		}
-                debug = fmt.Sprintf("Killing ffmpeg process...")
-                showDebug(debug, 2)
+	if native, ok := backend.(*nativeBackend); ok && native.StallTimeout() > timeout {
+		return native.StallTimeout()
+	}
 
-		cmd.Process.Kill()
-		cmd.Wait()
+	return timeout
+}
 
-		err = errors.New(bufferType + " error")
-		addErrorToStream(err)
-		ShowError(err, 1204)
+// updateStream : Changes the information of an active stream
+func updateStream(playlistID string, streamID int, update func(stream *ThisStream)) {
 
-		time.Sleep(time.Duration(500) * time.Millisecond)
-		clientConnection(stream)
+	Lock.Lock()
+	defer Lock.Unlock()
 
-		return
+	if p, ok := BufferInformation.Load(playlistID); ok {
+
+		if stream, ok := p.(*Playlist).Streams[streamID]; ok {
+			update(stream)
+		}
 
 	}
 
@@ -1219,33 +1146,60 @@ func thirdPartyBuffer(streamID int, playlistID string, useBackup bool, backupNum
 
 func getTuner(id, playlistType string) (tuner int) {
 
-	var playListBuffer string
-	systemMutex.Lock()
-	playListInterface := Settings.Files.M3U[id]
-	if playListInterface == nil {
-		playListInterface = Settings.Files.HDHR[id]
+	i, err := strconv.Atoi(getProviderParameter(id, playlistType, "tuner"))
+	if err == nil {
+		tuner = i
+	} else {
+		ShowError(err, 0)
+		tuner = 1
 	}
-        // Hard set to ffmpeg
-        playListBuffer = "ffmpeg"
-	systemMutex.Unlock()
 
-	switch playListBuffer {
+	return
+}
 
-        case "ffmpeg":
-		i, err := strconv.Atoi(getProviderParameter(id, playlistType, "tuner"))
-		if err == nil {
-			tuner = i
-		} else {
-			ShowError(err, 0)
-			tuner = 1
+// initBufferVFS : Filesystem for the buffer, RAM or the temporary folder. Running streams keep their filesystem.
+func initBufferVFS() {
+
+	var vfs avfs.VFS
+
+	if !Settings.StoreBufferInRAM {
+
+		var err error
+
+		if vfs, err = newDiskVFS(); err != nil {
+			ShowError(err, 4008)
+			vfs = nil
 		}
 
 	}
 
-	return
+	if vfs == nil {
+		vfs = memfs.New()
+	}
+
+	bufferVFSMutex.Lock()
+	bufferVFS = vfs
+	bufferVFSMutex.Unlock()
+
 }
 
-func initBufferVFS() {
-	bufferVFS = memfs.New()
+// newDiskVFS : Filesystem in the folder for the temporary files
+func newDiskVFS() (vfs avfs.VFS, err error) {
+
+	var tmpFolder = getPlatformPath(System.Folder.Temp)
+
+	if err = checkFolder(tmpFolder); err != nil {
+		return
+	}
+
+	return basepathfs.NewWithErr(osfs.New(), tmpFolder)
 }
 
+// getBufferVFS : Current filesystem for new buffers
+func getBufferVFS() avfs.VFS {
+
+	bufferVFSMutex.RLock()
+	defer bufferVFSMutex.RUnlock()
+
+	return bufferVFS
+}
@@ -24,14 +24,15 @@ var Data DataStruct
 // SystemFiles : All system files
 var SystemFiles = []string{"authentication.json", "pms.json", "settings.json", "xepg.json", "urls.json"}
 
-// BufferInformation : Information about the buffer (active streams, maximum streams)
+// BufferInformation : Information about the buffer (active streams, maximum streams). Contains *Playlist, which is only changed with the lock held.
 var BufferInformation sync.Map
 
-// bufferVFS : Filesystem to use for the buffer
+// bufferVFS : Filesystem to use for the buffer, is replaced when the settings are saved (bufferVFSMutex)
 var bufferVFS avfs.VFS
+var bufferVFSMutex sync.RWMutex
 
-// BufferClients : Number of clients playing a stream via the buffer
-var BufferClients sync.Map
+// streamBuffers : Ring buffers of the active streams (playlistID + MD5)
+var streamBuffers sync.Map
 
 // Lock : Lock Map
 var Lock = sync.RWMutex{}
@@ -41,6 +42,9 @@ var (
 	infoMutex   sync.Mutex
 	logMutex    sync.Mutex
 	systemMutex sync.Mutex
+
+	// Changes of the settings by the web interface and the recorder
+	settingsMutex sync.Mutex
 )
 
 // Init : System initialisation
@@ -80,6 +84,8 @@ func Init() (err error) {
 	System.Folder.Config = getPlatformPath(System.Folder.Config)
 	System.Folder.Backup = System.Folder.Config + "backup" + string(os.PathSeparator)
 	System.Folder.Data = System.Folder.Config + "data" + string(os.PathSeparator)
+	System.Folder.Recordings = System.Folder.Config + "recordings" + string(os.PathSeparator)
+	System.Folder.Slates = System.Folder.Data + "slates" + string(os.PathSeparator)
 	System.Folder.Cache = System.Folder.Config + "cache" + string(os.PathSeparator)
 	System.Folder.ImagesCache = System.Folder.Cache + "images" + string(os.PathSeparator)
 	System.Folder.ImagesUpload = System.Folder.Data + "images" + string(os.PathSeparator)
@@ -158,10 +164,14 @@ func Init() (err error) {
 		return
 	}
 
-	err = removeChildItems(getPlatformPath(System.Folder.Temp))
-	if err != nil {
-		return
-	}
+	// Remove orphaned buffer folders of the last run
+	cleanupBufferFolders()
+
+	// Initialize the filesystem for the buffer
+	initBufferVFS()
+
+	// Create the missing slates in the background, FFmpeg needs a few seconds
+	go initSlates()
 
 	// Set base URI
 	if Settings.HttpThreadfinDomain != "" {
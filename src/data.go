@@ -18,6 +18,9 @@ import (
 // Change settings (WebUI)
 func updateServerSettings(request RequestStruct) (settings SettingsStruct, err error) {
 
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
 	var oldSettings = jsonToMap(mapToJSON(Settings))
 	var newSettings = jsonToMap(mapToJSON(request.Settings))
 	var reloadData = false
@@ -68,7 +71,7 @@ func updateServerSettings(request RequestStruct) (settings SettingsStruct, err e
 			case "xepg.replace.channel.title":
 				createXEPGFiles = true
 
-			case "backup.path":
+			case "backup.path", "recordings.path":
 				value = strings.TrimRight(value.(string), string(os.PathSeparator)) + string(os.PathSeparator)
 				err = checkFolder(value.(string))
 				if err == nil {
@@ -100,7 +103,7 @@ func updateServerSettings(request RequestStruct) (settings SettingsStruct, err e
 					return
 				}
 
-                        case "ffmpeg.path":
+                        case "ffmpeg.path", "transcode.path":
 				var path = value.(string)
 				if len(path) > 0 {
 
@@ -114,6 +117,11 @@ func updateServerSettings(request RequestStruct) (settings SettingsStruct, err e
 			case "scheme.m3u", "scheme.xml":
 				createXEPGFiles = true
 
+			case "buffer.profiles", "buffer.profile.groups", "buffer.timeshift.minutes":
+				// The profile and time shift of a channel are stored with the streaming URL
+				Data.Cache.StreamingURLS = make(map[string]StreamInfo)
+				createXEPGFiles = true
+
 			}
 
 			oldSettings[key] = value
@@ -192,7 +200,7 @@ func updateServerSettings(request RequestStruct) (settings SettingsStruct, err e
 
 			if Settings.EpgSource == "XEPG" && System.ImageCachingInProgress == 0 {
 
-				Data.Cache.Images, err = imgcache.New(System.Folder.ImagesCache, fmt.Sprintf("%s://%s/images/", System.ServerProtocol.WEB, System.Domain), Settings.CacheImages)
+				Data.Cache.Images, err = imgcache.New(System.Folder.ImagesCache, fmt.Sprintf("%s://%s/images/", System.ServerProtocol.WEB, System.Domain), Settings.CacheImages, downloadImage)
 				if err != nil {
 					ShowError(err, 0)
 				}
@@ -495,7 +503,7 @@ func saveXEpgMapping(request RequestStruct) (err error) {
 
 	Data.Cache.StreamingURLS = make(map[string]StreamInfo)
 
-	Data.Cache.Images, err = imgcache.New(System.Folder.ImagesCache, fmt.Sprintf("%s://%s/images/", System.ServerProtocol.WEB, System.Domain), Settings.CacheImages)
+	Data.Cache.Images, err = imgcache.New(System.Folder.ImagesCache, fmt.Sprintf("%s://%s/images/", System.ServerProtocol.WEB, System.Domain), Settings.CacheImages, downloadImage)
 	if err != nil {
 		ShowError(err, 0)
 	}
@@ -0,0 +1,435 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// bufferSource : Upstream of a stream, the streaming URL of the channel or one of its backup channels
+type bufferSource struct {
+	Name     string
+	URL      string
+	Playlist Playlist
+}
+
+// streamFailback : Tries to connect to the primary source again while a backup channel is used.
+// The connection test uses the tuner of the stream. If the backup channel uses this tuner itself (same provider), the test needs an additional tuner.
+type streamFailback struct {
+	source      bufferSource
+	profile     BufferProfile
+	delay       time.Duration
+	tunerKey    string // Tuner of the stream
+	channelName string
+
+	timer  *time.Timer
+	shared bool   // The backup channel uses the tuner of the stream
+	probe  string // Additional tuner of the connection test, until the backup channel is stopped
+	ready  chan BufferBackend
+	done   chan struct{}
+	stop   sync.Once
+	mutex  sync.Mutex
+}
+
+// failbackBackend : Backend of the primary source, the data of the connection test is delivered first
+type failbackBackend struct {
+	BufferBackend
+	data []byte
+}
+
+// tsWriter : Writes complete MPEG-TS packets into the buffer. After a change of the source, the data is synchronized to the next packet.
+// The packets are analyzed, the buffer receives the program tables and starts new segments at keyframes.
+// While no source delivers data, a slate can be written into the buffer, it is stopped by the next data of a source.
+type tsWriter struct {
+	buffer  *streamBuffer
+	parser  *tsParser
+	pending []byte
+	synced  bool
+	raw     bool
+	slate   *slatePlayer
+}
+
+// Size of an MPEG-TS packet
+const tsPacketSize = 188
+
+// First byte of every MPEG-TS packet
+const tsSyncByte = 0x47
+
+// Data in which no MPEG-TS packet is found up to this size is written into the buffer unchanged
+const tsSyncLimit = 64 * 1024
+
+// Time in which the buffer has to take over the primary source after a successful connection test, afterwards the connection is closed
+const failbackHandoverTimeout = 10 * time.Second
+
+// getBufferSources : Sources of a stream in the order in which they are used. Backup channels use the settings of their provider.
+func getBufferSources(playlist Playlist, stream ThisStream) (sources []bufferSource) {
+
+	sources = append(sources, bufferSource{Name: "Primary", URL: stream.URL, Playlist: playlist})
+
+	for i, backup := range stream.BackupChannels {
+
+		if len(backup.URL) == 0 {
+			continue
+		}
+
+		var source = bufferSource{Name: fmt.Sprintf("Backup %d", i+1), URL: backup.URL, Playlist: playlist}
+
+		if backup.PlaylistID != playlist.PlaylistID {
+			source.Playlist = *newBufferPlaylist(backup.PlaylistID)
+		}
+
+		sources = append(sources, source)
+
+	}
+
+	return
+}
+
+// getSourceTunerKey : Tuner of a backup channel of another provider, the other sources use the tuner of the stream (empty)
+func getSourceTunerKey(source bufferSource, stream ThisStream) string {
+
+	if source.Playlist.PlaylistID == stream.PlaylistID {
+		return ""
+	}
+
+	return stream.PlaylistID + stream.MD5 + "/" + source.Playlist.PlaylistID + getStreamMD5(source.URL, stream.Transcode)
+}
+
+// startBufferSource : Creates and starts the backend for the source
+func startBufferSource(source bufferSource, profile BufferProfile) (backend BufferBackend, err error) {
+
+	showInfo("Streaming URL:" + source.URL)
+
+	backend, err = newBufferBackend(source.Playlist, profile, source.URL)
+	if err != nil {
+		return
+	}
+
+	err = backend.Start()
+	if err != nil {
+		backend.Stop()
+		return nil, err
+	}
+
+	return
+}
+
+// probeBufferSource : Starts the source and waits for the first data within the startup timeout of the profile
+func probeBufferSource(source bufferSource, profile BufferProfile) (backend BufferBackend, err error) {
+
+	backend, err = startBufferSource(source, profile)
+	if err != nil {
+		return
+	}
+
+	var timeout = time.AfterFunc(time.Duration(profile.StartupTimeout)*time.Second, backend.Stop)
+	var data = make([]byte, 1024*4)
+
+	n, err := backend.Read(data)
+	timeout.Stop()
+
+	if err == nil && n == 0 {
+		err = errors.New("No data")
+	}
+
+	if err != nil {
+		backend.Stop()
+		return nil, err
+	}
+
+	backend = &failbackBackend{BufferBackend: backend, data: data[:n]}
+
+	return
+}
+
+func (b *failbackBackend) Read(p []byte) (n int, err error) {
+
+	if len(b.data) > 0 {
+		n = copy(p, b.data)
+		b.data = b.data[n:]
+		return
+	}
+
+	return b.BufferBackend.Read(p)
+}
+
+// newStreamFailback : Failback to the primary source, the delay is set in the settings (0: off)
+func newStreamFailback(source bufferSource, profile BufferProfile, stream ThisStream) (failback *streamFailback) {
+
+	failback = &streamFailback{source: source, profile: profile, tunerKey: stream.PlaylistID + stream.MD5, channelName: stream.ChannelName}
+	failback.delay = time.Duration(Settings.BufferFailback) * time.Minute
+	failback.ready = make(chan BufferBackend)
+	failback.done = make(chan struct{})
+
+	return
+}
+
+// Schedule : Starts the timer for the next attempt while the backup channel is used, unless one is already scheduled
+func (f *streamFailback) Schedule(backup bufferSource) {
+
+	if f.delay <= 0 {
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.shared = backup.Playlist.PlaylistID == f.source.Playlist.PlaylistID
+
+	if f.timer == nil {
+		f.timer = time.AfterFunc(f.delay, f.attempt)
+	}
+
+}
+
+// Ready : Receives the backend of the primary source as soon as it delivers data again
+func (f *streamFailback) Ready() <-chan BufferBackend {
+	return f.ready
+}
+
+// Reset : The primary source is used again, the backup channel has been stopped
+func (f *streamFailback) Reset() {
+
+	f.mutex.Lock()
+	f.timer = nil
+	f.mutex.Unlock()
+
+	f.releaseProbe()
+
+}
+
+// Stop : Cancels the scheduled attempt, a connection that is not used anymore is closed
+func (f *streamFailback) Stop() {
+
+	f.stop.Do(func() {
+
+		close(f.done)
+
+		f.mutex.Lock()
+		if f.timer != nil {
+			f.timer.Stop()
+		}
+		f.mutex.Unlock()
+
+		f.releaseProbe()
+
+	})
+
+}
+
+// attempt : Connects to the primary source, if it does not deliver data the next attempt is scheduled
+func (f *streamFailback) attempt() {
+
+	if !f.acquireProbe() {
+		f.retry("No tuner is available")
+		return
+	}
+
+	backend, err := probeBufferSource(f.source, f.profile)
+	if err != nil {
+		f.releaseProbe()
+		f.retry(err.Error())
+		return
+	}
+
+	var timer = time.NewTimer(failbackHandoverTimeout)
+	defer timer.Stop()
+
+	select {
+
+	// The additional tuner is released by Reset, after the backup channel has been stopped
+	case f.ready <- backend:
+		return
+
+	case <-f.done:
+
+	case <-timer.C:
+		f.retry("The buffer did not take over the connection")
+
+	}
+
+	backend.Stop()
+	f.releaseProbe()
+
+}
+
+// retry : Schedules the next attempt
+func (f *streamFailback) retry(reason string) {
+
+	showInfo(fmt.Sprintf("Failback:%s is not available (%s). Next attempt in %d minutes", f.source.Name, reason, int(f.delay.Minutes())))
+
+	f.mutex.Lock()
+	if f.timer != nil {
+		f.timer.Reset(f.delay)
+	}
+	f.mutex.Unlock()
+
+}
+
+// acquireProbe : Tuner for the connection test. No stream is stopped for the test, false if the stream has no tuner anymore or no additional tuner is free.
+func (f *streamFailback) acquireProbe() bool {
+
+	if !tuners.Holds(f.tunerKey) {
+		return false
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.shared {
+		return true
+	}
+
+	var key = f.tunerKey + "/failback"
+
+	// The connection test has the lowest priority, no other stream is stopped for it
+	if !tuners.acquire(&tunerSlot{PlaylistID: f.source.Playlist.PlaylistID, Key: key, ChannelName: f.channelName, Priority: tunerWarmPriority}) {
+		return false
+	}
+
+	f.probe = key
+
+	return true
+}
+
+// releaseProbe : Releases the additional tuner of the connection test
+func (f *streamFailback) releaseProbe() {
+
+	f.mutex.Lock()
+	var key = f.probe
+	f.probe = ""
+	f.mutex.Unlock()
+
+	if len(key) > 0 {
+		tuners.Release(key)
+	}
+
+}
+
+func newTSWriter(buffer *streamBuffer) *tsWriter {
+	return &tsWriter{buffer: buffer, parser: newTSParser()}
+}
+
+func (t *tsWriter) Write(p []byte) (n int, err error) {
+
+	n = len(p)
+
+	t.StopSlate()
+
+	if t.raw {
+		_, err = t.buffer.Write(p)
+		return
+	}
+
+	t.pending = append(t.pending, p...)
+
+	for {
+
+		if !t.synced {
+
+			var i = tsSync(t.pending)
+			if i < 0 {
+
+				if len(t.pending) > tsSyncLimit {
+					showDebug("Buffer:Stream data is not MPEG-TS, packets are not aligned", 2)
+					t.raw = true
+					_, err = t.buffer.Write(t.pending)
+					t.pending = t.pending[:0]
+				}
+
+				return
+			}
+
+			t.pending = t.pending[i:]
+			t.synced = true
+
+		}
+
+		var size = len(t.pending) - len(t.pending)%tsPacketSize
+		if size == 0 {
+			return
+		}
+
+		var written int
+		written, err = t.writePackets(t.pending[:size])
+		t.pending = append(t.pending[:0], t.pending[written:]...)
+
+		if err != nil || t.synced {
+			return
+		}
+
+		showDebug("Buffer:MPEG-TS packets are not aligned anymore, synchronizing again", 2)
+
+	}
+
+}
+
+// writePackets : Writes the packets into the buffer, a keyframe starts a new segment. Returns the size of the written packets.
+// It stops at a packet without sync byte, Write synchronizes the rest of the data again.
+func (t *tsWriter) writePackets(data []byte) (written int, err error) {
+
+	var start = 0
+
+	for ; written+tsPacketSize <= len(data); written += tsPacketSize {
+
+		var i = written
+
+		if data[i] != tsSyncByte {
+			t.synced = false
+			break
+		}
+
+		keyframe, tables := t.parser.Packet(data[i : i+tsPacketSize])
+
+		if tables {
+			if tables := t.parser.Tables(); tables != nil {
+				t.buffer.SetTables(tables)
+			}
+		}
+
+		if keyframe {
+
+			if i > start {
+				if _, err = t.buffer.Write(data[start:i]); err != nil {
+					return
+				}
+			}
+
+			t.buffer.Keyframe()
+			start = i
+
+		}
+
+	}
+
+	if written > start {
+		_, err = t.buffer.Write(data[start:written])
+	}
+
+	return
+}
+
+// Reset : The next data comes from another source, the incomplete packet of the previous source is dropped
+func (t *tsWriter) Reset() {
+
+	t.pending = t.pending[:0]
+	t.synced = false
+	t.raw = false
+	t.parser = newTSParser()
+
+}
+
+// tsSync : Position of the first MPEG-TS packet, confirmed by the sync byte of the following packet
+func tsSync(data []byte) int {
+
+	for i := 0; i+tsPacketSize < len(data); i++ {
+
+		if data[i] == tsSyncByte && data[i+tsPacketSize] == tsSyncByte {
+			return i
+		}
+
+	}
+
+	return -1
+}
@@ -0,0 +1,133 @@
+package src
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+// newTestBuffer : Ring buffer in RAM that is not registered as a stream buffer
+func newTestBuffer(segmentSize, maxSegments int) *streamBuffer {
+
+	var buffer = &streamBuffer{Key: "test", segmentSize: segmentSize, maxSegments: maxSegments, done: make(chan struct{})}
+	buffer.cond = sync.NewCond(&buffer.mutex)
+
+	return buffer
+}
+
+// bufferData : Data of all segments in the buffer
+func bufferData(buffer *streamBuffer) (data []byte) {
+
+	for _, segment := range buffer.segments {
+		data = append(data, segment.Data...)
+	}
+
+	return
+}
+
+func TestTSWriter(t *testing.T) {
+
+	var pat = newTestPAT(testPMTPID)
+	var pmt = newTestPMT(tsStreamH264, testVideoPID)
+	var slice = newTestPES(testVideoPID, false, 0x00, 0x00, 0x01, 0x41)
+	var audio = newTestPES(testAudioPID, false)
+
+	var join = func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	var garbage = make([]byte, 100)
+
+	var tests = []struct {
+		name   string
+		chunks [][]byte
+		data   []byte
+	}{
+		{
+			name:   "aligned packets",
+			chunks: [][]byte{join(pat, pmt, slice, audio)},
+			data:   join(pat, pmt, slice, audio),
+		},
+		{
+			name:   "packets split across writes",
+			chunks: [][]byte{pat[:100], join(pat[100:], pmt[:1]), join(pmt[1:], slice, audio[:187]), audio[187:]},
+			data:   join(pat, pmt, slice, audio),
+		},
+		{
+			name:   "data before the first packet",
+			chunks: [][]byte{join(garbage, pat, pmt, slice)},
+			data:   join(pat, pmt, slice),
+		},
+		{
+			name:   "corrupted packet",
+			chunks: [][]byte{join(pat, pmt, garbage, slice, audio, slice)},
+			data:   join(pat, pmt, slice, audio, slice),
+		},
+		{
+			name:   "corrupted packet in a later write",
+			chunks: [][]byte{join(pat, pmt), garbage, join(audio, slice, audio)},
+			data:   join(pat, pmt, audio, slice, audio),
+		},
+		{
+			name:   "incomplete packet",
+			chunks: [][]byte{join(pat, pmt, slice, audio[:100])},
+			data:   join(pat, pmt, slice),
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			var buffer = newTestBuffer(100*tsPacketSize, bufferSegments)
+			var writer = newTSWriter(buffer)
+
+			for _, chunk := range test.chunks {
+
+				if n, err := writer.Write(chunk); err != nil || n != len(chunk) {
+					t.Fatalf("Write() = %d, %v, want %d, nil", n, err, len(chunk))
+				}
+
+			}
+
+			if data := bufferData(buffer); !bytes.Equal(data, test.data) {
+				t.Errorf("buffer contains %d bytes (%d packets), want %d bytes (%d packets)", len(data), len(data)/tsPacketSize, len(test.data), len(test.data)/tsPacketSize)
+			}
+
+		})
+
+	}
+
+}
+
+func TestTSWriterKeyframe(t *testing.T) {
+
+	var pat = newTestPAT(testPMTPID)
+	var pmt = newTestPMT(tsStreamH264, testVideoPID)
+	var idr = newTestPES(testVideoPID, false, 0x00, 0x00, 0x01, 0x65)
+	var slice = newTestPES(testVideoPID, false, 0x00, 0x00, 0x01, 0x41)
+
+	var buffer = newTestBuffer(100*tsPacketSize, bufferSegments)
+	var writer = newTSWriter(buffer)
+
+	writer.Write(bytes.Join([][]byte{pat, pmt, slice, idr, slice, slice}, nil))
+
+	if len(buffer.segments) != 2 {
+		t.Fatalf("buffer contains %d segments, want 2", len(buffer.segments))
+	}
+
+	var first, second = buffer.segments[0], buffer.segments[1]
+
+	if !first.Sealed || first.Keyframe || first.Size != 3*tsPacketSize {
+		t.Errorf("first segment: sealed = %t, keyframe = %t, size = %d, want true, false, %d", first.Sealed, first.Keyframe, first.Size, 3*tsPacketSize)
+	}
+
+	if second.Sealed || !second.Keyframe || !bytes.Equal(second.Data[:tsPacketSize], idr) {
+		t.Errorf("second segment: sealed = %t, keyframe = %t, want false, true and the IDR packet first", second.Sealed, second.Keyframe)
+	}
+
+	if !bytes.Equal(second.Tables, bytes.Join([][]byte{pat, pmt}, nil)) {
+		t.Errorf("second segment does not carry the PAT and the PMT")
+	}
+
+}
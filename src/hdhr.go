@@ -41,6 +41,8 @@ type Discover struct {
         Manufacturer    string `json:"Manufacturer"`
         ModelNumber     string `json:"ModelNumber"`
         TunerCount      int    `json:"TunerCount"`
+
+        TranscodeProfiles []string `json:"TranscodeProfiles,omitempty"`
 }
 
 // LineupStatus : HDHR Lineup status /lineup_status.json
@@ -139,7 +141,10 @@ func getDiscover() (jsonContent []byte, err error) {
 	discover.LineupURL = fmt.Sprintf("%s://%s/lineup.json", System.ServerProtocol.DVR, System.Domain)
 	discover.Manufacturer = "Golang"
 	discover.ModelNumber = System.Version
-	discover.TunerCount = Settings.Tuner
+	discover.TunerCount = getTunerCount()
+
+	// Transcoding profiles that clients can request with ?transcode=
+	discover.TranscodeProfiles = getTranscodeProfileNames()
 
 	jsonContent, err = json.MarshalIndent(discover, "", "  ")
 
@@ -160,7 +165,8 @@ func getLineupStatus() (jsonContent []byte, err error) {
 	return
 }
 
-func getLineup() (jsonContent []byte, err error) {
+// getLineup : Channels for Plex / Emby (lineup.json), the streaming URLs are bound to the user of the request
+func getLineup(user string) (jsonContent []byte, err error) {
 
 	var lineup Lineup
 
@@ -194,7 +200,7 @@ func getLineup() (jsonContent []byte, err error) {
 
 			}
 
-			stream.URL, err = createStreamingURL("DVR", m3uChannel.FileM3UID, stream.GuideNumber, m3uChannel.Name, m3uChannel.URL, nil, nil, nil)
+			stream.URL, err = createStreamingURL("DVR", m3uChannel.FileM3UID, stream.GuideNumber, m3uChannel.Name, m3uChannel.URL, nil, getBufferProfileName(m3uChannel.FileM3UID, m3uChannel.GroupTitle, ""), getTimeShift(""), user)
 			if err == nil {
 				lineup = append(lineup, stream)
 			} else {
@@ -216,7 +222,7 @@ func getLineup() (jsonContent []byte, err error) {
 				var stream LineupStream
 				stream.GuideName = xepgChannel.XName
 				stream.GuideNumber = xepgChannel.XChannelID
-				stream.URL, err = createStreamingURL("DVR", xepgChannel.FileM3UID, xepgChannel.XChannelID, xepgChannel.XName, xepgChannel.URL, xepgChannel.BackupChannel1, xepgChannel.BackupChannel2, xepgChannel.BackupChannel3)
+				stream.URL, err = createStreamingURL("DVR", xepgChannel.FileM3UID, xepgChannel.XChannelID, xepgChannel.XName, xepgChannel.URL, xepgChannel.BackupChannels, getBufferProfileName(xepgChannel.FileM3UID, xepgChannel.XGroupTitle, xepgChannel.XBufferProfile), getTimeShift(xepgChannel.XTimeShift), user)
 				if err == nil {
 					lineup = append(lineup, stream)
 				} else {
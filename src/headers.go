@@ -0,0 +1,232 @@
+package src
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// providerHTTP : HTTP options of a provider. They are used for all requests to the provider (playlist, XMLTV, images, streams and the buffer process).
+type providerHTTP struct {
+	UserAgent string         // http_headers.user_agent, otherwise user.agent
+	Headers   http.Header    // http_headers, http_headers.origin, http_headers.referer and http_headers.cookies
+	Proxy     string         // http_proxy.ip and http_proxy.port
+	Jar       http.CookieJar // http_headers.cookie_jar: Cookies that the provider sets are sent with all following requests
+}
+
+// imageSource : Provider of a cached image
+type imageSource struct {
+	ID       string
+	FileType string
+}
+
+// providerCookieJars : Provider ID -> *cookiejar.Jar, the cookies are kept until Threadfin is restarted
+var providerCookieJars sync.Map
+
+// imageSources : Image URL -> imageSource, images of unknown providers are downloaded with the global user agent
+var imageSources sync.Map
+
+// getProviderHTTP : HTTP options of a provider (M3U, HDHR or XMLTV)
+func getProviderHTTP(id, fileType string) (provider providerHTTP) {
+
+	provider.UserAgent = Settings.UserAgent
+	provider.Headers = make(http.Header)
+
+	var data = getProviderSettings(id, fileType)
+	if data == nil {
+		return
+	}
+
+	// Additional headers, as map (settings.json, API) or as "Name: Value|Name: Value" (web interface)
+	switch headers := data["http_headers"].(type) {
+
+	case map[string]interface{}:
+		for name, value := range headers {
+			if v, ok := value.(string); ok && len(name) > 0 {
+				provider.Headers.Set(name, v)
+			}
+		}
+
+	case string:
+		for _, header := range strings.Split(headers, "|") {
+			if name, value, ok := strings.Cut(header, ":"); ok && len(strings.TrimSpace(name)) > 0 {
+				provider.Headers.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+			}
+		}
+
+	}
+
+	var values = map[string]string{
+		"Origin":  "http_headers.origin",
+		"Referer": "http_headers.referer",
+		"Cookie":  "http_headers.cookies",
+	}
+
+	for header, key := range values {
+		if value, ok := data[key].(string); ok && len(value) > 0 {
+			provider.Headers.Set(header, value)
+		}
+	}
+
+	// The user agent is not sent as header, FFmpeg and the clients get it separately
+	if userAgent := provider.Headers.Get("User-Agent"); len(userAgent) > 0 {
+		provider.UserAgent = userAgent
+		provider.Headers.Del("User-Agent")
+	}
+
+	if userAgent, ok := data["http_headers.user_agent"].(string); ok && len(userAgent) > 0 {
+		provider.UserAgent = userAgent
+	}
+
+	ip, _ := data["http_proxy.ip"].(string)
+	port, _ := data["http_proxy.port"].(string)
+
+	if len(ip) > 0 && len(port) > 0 {
+		provider.Proxy = fmt.Sprintf("http://%s:%s", ip, port)
+	}
+
+	if cookieJar, ok := data["http_headers.cookie_jar"].(bool); ok && cookieJar {
+
+		jar, _ := cookiejar.New(nil)
+
+		value, _ := providerCookieJars.LoadOrStore(id, jar)
+		provider.Jar = value.(*cookiejar.Jar)
+
+	}
+
+	return
+}
+
+// getProviderSettings : Settings of a provider file, nil if the provider does not exist
+func getProviderSettings(id, fileType string) (data map[string]interface{}) {
+
+	var dataMap map[string]interface{}
+
+	switch fileType {
+	case "m3u":
+		dataMap = Settings.Files.M3U
+
+	case "hdhr":
+		dataMap = Settings.Files.HDHR
+
+	case "xmltv":
+		dataMap = Settings.Files.XMLTV
+	}
+
+	data, _ = dataMap[id].(map[string]interface{})
+
+	return
+}
+
+// Header : Headers for a request to the provider, including the user agent
+func (p providerHTTP) Header() (header http.Header) {
+
+	header = p.Headers.Clone()
+
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	if len(p.UserAgent) > 0 {
+		header.Set("User-Agent", p.UserAgent)
+	}
+
+	return
+}
+
+// Client : HTTP client with the proxy and the cookie jar of the provider
+func (p providerHTTP) Client() (client *http.Client) {
+
+	client = &http.Client{Jar: p.Jar}
+
+	if len(p.Proxy) > 0 {
+
+		proxyURL, err := url.Parse(p.Proxy)
+		if err == nil {
+			client.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+		}
+
+	}
+
+	return
+}
+
+// FFmpegHeaders : Headers for the -headers option of FFmpeg ("Name: Value\r\n"), with the cookies of the jar for the streaming URL. The user agent is not included.
+func (p providerHTTP) FFmpegHeaders(streamingURL string) (headers string) {
+
+	var header = p.Headers.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	if p.Jar != nil {
+
+		if u, err := url.Parse(streamingURL); err == nil {
+
+			var cookies []string
+			for _, cookie := range p.Jar.Cookies(u) {
+				cookies = append(cookies, cookie.String())
+			}
+
+			if len(cookies) > 0 {
+
+				if static := header.Get("Cookie"); len(static) > 0 {
+					cookies = append([]string{static}, cookies...)
+				}
+
+				header.Set("Cookie", strings.Join(cookies, "; "))
+
+			}
+
+		}
+
+	}
+
+	var names = make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		headers += fmt.Sprintf("%s: %s\r\n", name, header.Get(name))
+	}
+
+	return
+}
+
+// setImageSource : Images are cached with the HTTP options of the provider of the playlist or XMLTV file. The first provider of an image is used.
+func setImageSource(src, id, fileType string) {
+
+	if !Settings.CacheImages || len(src) == 0 || len(id) == 0 {
+		return
+	}
+
+	imageSources.LoadOrStore(strings.Trim(src, "\r\n"), imageSource{ID: id, FileType: fileType})
+
+}
+
+// downloadImage : Downloads an image for the image cache
+func downloadImage(src string) (resp *http.Response, err error) {
+
+	var provider = providerHTTP{UserAgent: Settings.UserAgent}
+
+	if value, ok := imageSources.Load(src); ok {
+		var source = value.(imageSource)
+		provider = getProviderHTTP(source.ID, source.FileType)
+	}
+
+	req, err := http.NewRequest("GET", src, nil)
+	if err != nil {
+		return
+	}
+
+	req.Header = provider.Header()
+
+	return provider.Client().Do(req)
+}
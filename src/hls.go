@@ -0,0 +1,233 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hlsSession : HLS client. It is counted like a TS client until it stops requesting the playlist.
+type hlsSession struct {
+	ID          string
+	URLID       string // Channel of the session, the session is only valid for the playlist and segments of this channel
+	PlaylistID  string
+	StreamID    int
+	ChannelName string
+
+	buffer  *streamBuffer
+	session *StreamSession
+	timer   *time.Timer
+
+	// The target duration of an HLS playlist must not change, it is set with the first playlist of the session
+	targetDuration atomic.Int64
+}
+
+// hlsSessions : Active HLS clients (session ID)
+var hlsSessions sync.Map
+
+// Number of segments in the HLS playlist
+const hlsPlaylistSegments = 6
+
+// Time without requests after which an HLS client is removed
+const hlsSessionTimeout = 30 * time.Second
+
+// streamHLS : Web Server /stream/<urlID>/index.m3u8 and /stream/<urlID>/<sequence>.ts
+func streamHLS(urlID string, streamInfo StreamInfo, file string, w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var session = getHLSSession(r.URL.Query().Get("session"), urlID)
+	if session != nil {
+		session.timer.Reset(hlsSessionTimeout)
+	}
+
+	switch {
+
+	case file == "index.m3u8":
+
+		// New HLS client, the session ID is part of the playlist URL, so that the client keeps it when the playlist is reloaded
+		if session == nil {
+
+			session = newHLSSession(urlID, streamInfo, r)
+			if session == nil {
+				httpStatusError(w, r, 503)
+				return
+			}
+
+			var query = r.URL.Query()
+			query.Set("session", session.ID)
+
+			http.Redirect(w, r, fmt.Sprintf("%s?%s", r.URL.Path, query.Encode()), http.StatusFound)
+			return
+		}
+
+		var buffer = session.buffer
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(getBufferProfile(streamInfo.BufferProfile).StartupTimeout)*time.Second)
+		defer cancel()
+
+		if err := buffer.WaitReady(ctx); err != nil {
+			ShowError(err, 0)
+			session.close()
+			httpStatusError(w, r, 404)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("Cache-Control", "no-cache")
+		var segments = buffer.Segments(hlsPlaylistSegments)
+		session.targetDuration.CompareAndSwap(0, getHLSTargetDuration(segments))
+
+		w.Write([]byte(buildHLSPlaylist(segments, session.targetDuration.Load(), r.URL.Query())))
+
+	case strings.HasSuffix(file, ".ts"):
+
+		if session == nil {
+			httpStatusError(w, r, 404)
+			return
+		}
+
+		sequence, err := strconv.ParseInt(strings.TrimSuffix(file, ".ts"), 10, 64)
+		if err != nil {
+			httpStatusError(w, r, 404)
+			return
+		}
+
+		data, err := session.buffer.SegmentData(sequence)
+		if err != nil {
+			showDebug(fmt.Sprintf("HLS:%s", err.Error()), 2)
+			httpStatusError(w, r, 404)
+			return
+		}
+
+		w.Header().Set("Content-Type", "video/mp2t")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+
+		n, _ := w.Write(data)
+		session.session.Sent(n)
+
+	default:
+		httpStatusError(w, r, 404)
+
+	}
+
+}
+
+// getHLSSession : Active HLS session of the channel, nil if the session does not exist or belongs to another channel
+func getHLSSession(id, urlID string) (session *hlsSession) {
+
+	if s, ok := hlsSessions.Load(id); ok && s.(*hlsSession).URLID == urlID {
+		session = s.(*hlsSession)
+	}
+
+	return
+}
+
+// newHLSSession : Registers an HLS client for the stream, nil if no tuner is available
+func newHLSSession(urlID string, streamInfo StreamInfo, r *http.Request) (session *hlsSession) {
+
+	playlistID, streamID, ok := connectStream(streamInfo.PlaylistID, streamInfo.URL, streamInfo.BackupChannels, streamInfo.Name, streamInfo.BufferProfile, streamInfo.TimeShift, r)
+	if !ok {
+		return nil
+	}
+
+	var buffer *streamBuffer
+
+	Lock.RLock()
+	if p, ok := BufferInformation.Load(playlistID); ok {
+
+		if stream, ok := p.(*Playlist).Streams[streamID]; ok {
+			buffer = stream.buffer
+		}
+
+	}
+	Lock.RUnlock()
+
+	if buffer == nil {
+		killClientConnection(streamID, playlistID)
+		return nil
+	}
+
+	session = &hlsSession{
+		ID:          randomString(16),
+		URLID:       urlID,
+		PlaylistID:  playlistID,
+		StreamID:    streamID,
+		ChannelName: streamInfo.Name,
+		buffer:      buffer,
+	}
+
+	session.timer = time.AfterFunc(hlsSessionTimeout, session.close)
+	session.session = newStreamSession("hls", playlistID, streamID, streamInfo.Name, r, session.close)
+
+	hlsSessions.Store(session.ID, session)
+
+	showInfo(fmt.Sprintf("HLS:Channel: %s - New session (%s)", session.ChannelName, session.ID))
+
+	return
+}
+
+// close : Removes the HLS client from the stream
+func (session *hlsSession) close() {
+
+	if _, ok := hlsSessions.LoadAndDelete(session.ID); !ok {
+		return
+	}
+
+	session.timer.Stop()
+	session.session.Close()
+
+	showInfo(fmt.Sprintf("HLS:Channel: %s - Session ended (%s)", session.ChannelName, session.ID))
+
+	killClientConnection(session.StreamID, session.PlaylistID)
+
+}
+
+// buildHLSPlaylist : HLS playlist with a sliding window of the newest segments
+func buildHLSPlaylist(segments []bufferSegment, targetDuration int64, query url.Values) (m3u8 string) {
+
+	m3u8 = "#EXTM3U\n"
+	m3u8 += "#EXT-X-VERSION:3\n"
+	m3u8 += fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", targetDuration)
+
+	if len(segments) > 0 {
+		m3u8 += fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d\n", segments[0].Sequence)
+		m3u8 += fmt.Sprintf("#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", segments[0].DiscontinuitySequence)
+	}
+
+	for i, segment := range segments {
+
+		// The source of the stream has changed (failover, slate)
+		if segment.Discontinuity && i > 0 {
+			m3u8 += "#EXT-X-DISCONTINUITY\n"
+		}
+
+		m3u8 += fmt.Sprintf("#EXTINF:%.3f,\n", segment.Duration.Seconds())
+		m3u8 += fmt.Sprintf("%d.ts?%s\n", segment.Sequence, query.Encode())
+	}
+
+	return
+}
+
+// getHLSTargetDuration : Target duration of an HLS playlist, the longest segment rounded up to full seconds
+func getHLSTargetDuration(segments []bufferSegment) (targetDuration int64) {
+
+	targetDuration = 1
+
+	for _, segment := range segments {
+
+		if d := int64(math.Ceil(segment.Duration.Seconds())); d > targetDuration {
+			targetDuration = d
+		}
+
+	}
+
+	return
+}
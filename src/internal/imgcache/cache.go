@@ -20,6 +20,7 @@ type Cache struct {
 	Queue    []string
 	Cache    []string
 	Image    imageFunc
+	download func(string) (*http.Response, error)
 	sync.RWMutex
 }
 
@@ -29,15 +30,20 @@ type imageFunc struct {
 	Remove  func()
 }
 
-// New : New cache
-func New(path, cacheURL string, caching bool) (c *Cache, err error) {
+// New : New cache. download: Function that downloads an image (nil: http.Get)
+func New(path, cacheURL string, caching bool, download func(string) (*http.Response, error)) (c *Cache, err error) {
 
 	c = &Cache{}
 
+	if download == nil {
+		download = http.Get
+	}
+
 	c.images = make(map[string]string)
 	c.path = path
 	c.cacheURL = cacheURL
 	c.caching = caching
+	c.download = download
 	c.Queue = []string{}
 	c.Cache = []string{}
 
@@ -106,7 +112,7 @@ func New(path, cacheURL string, caching bool) (c *Cache, err error) {
 
 		for _, src := range c.Queue {
 
-			resp, err := http.Get(src)
+			resp, err := c.download(src)
 			if err != nil {
 				continue
 			}
@@ -0,0 +1,208 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority of the tuners of warm streams without clients, every request has a higher priority and takes over the tuner
+const tunerWarmPriority = math.MinInt32
+
+// Interval in which the warm streams are started and stopped
+const keepWarmInterval = 30 * time.Second
+
+// warmChannels : Active channels with x-keep-warm (tuner key -> stream), updated with the channel list (updateWarmChannels)
+var warmChannels = make(map[string]StreamInfo)
+var warmChannelsMutex sync.RWMutex
+
+// keepWarm : Keeps the upstreams of the channels with x-keep-warm running without clients, as long as tuners are free.
+// Zapping to a warm channel starts immediately from the buffer.
+func keepWarm() {
+
+	for {
+
+		updateWarmStreams()
+		time.Sleep(keepWarmInterval)
+
+	}
+
+}
+
+// updateWarmStreams : Starts the warm streams for which a tuner is free and stops the warm streams of channels without x-keep-warm
+func updateWarmStreams() {
+
+	var channels = getWarmChannels()
+	var running = make(map[string]bool)
+	var stop []*streamBuffer
+
+	Lock.Lock()
+
+	BufferInformation.Range(func(key, value interface{}) bool {
+
+		var playlist = value.(*Playlist)
+
+		for streamID, stream := range playlist.Streams {
+
+			var tunerKey = playlist.PlaylistID + stream.MD5
+			var _, warm = channels[tunerKey]
+
+			// A stream that is stopping still uses the tuner
+			running[tunerKey] = true
+
+			if len(stream.Transcode) > 0 || stream.buffer == nil || stream.buffer.Closed() {
+				continue
+			}
+
+			switch {
+
+			// A stream of a warm channel that was started by a client keeps running when the client disconnects
+			case warm && !stream.Warm:
+				stream.Warm = true
+				go watchWarmStream(playlist.PlaylistID, streamID, stream)
+
+			case !warm && stream.Warm:
+				stream.Warm = false
+
+				if playlist.Clients[streamID].Connection == 0 {
+					stop = append(stop, stream.buffer)
+				}
+
+			}
+
+		}
+
+		return true
+	})
+
+	Lock.Unlock()
+
+	for _, buffer := range stop {
+		buffer.Close(nil)
+	}
+
+	for tunerKey, streamInfo := range channels {
+
+		if !running[tunerKey] {
+			startWarmStream(streamInfo)
+		}
+
+	}
+
+}
+
+// getWarmChannels : Active channels with x-keep-warm (tuner key -> stream), the map must not be changed
+func getWarmChannels() map[string]StreamInfo {
+
+	warmChannelsMutex.RLock()
+	defer warmChannelsMutex.RUnlock()
+
+	return warmChannels
+}
+
+// updateWarmChannels : Collects the channels with x-keep-warm, after the XEPG channels have been changed
+func updateWarmChannels() {
+
+	var channels = make(map[string]StreamInfo)
+
+	for _, dxc := range Data.XEPG.Channels {
+
+		var xepgChannel XEPGChannelStruct
+		if err := json.Unmarshal([]byte(mapToJSON(dxc)), &xepgChannel); err != nil {
+			continue
+		}
+
+		if !xepgChannel.XActive || !xepgChannel.XKeepWarm || len(xepgChannel.FileM3UID) == 0 {
+			continue
+		}
+
+		// The tuner key has to match the key of the clients, whose streaming URL is trimmed as well (getStreamInfo)
+		var streamInfo = StreamInfo{
+			Name:           xepgChannel.XName,
+			PlaylistID:     xepgChannel.FileM3UID,
+			URL:            strings.Trim(xepgChannel.URL, "\r\n"),
+			BackupChannels: xepgChannel.BackupChannels,
+			BufferProfile:  getBufferProfileName(xepgChannel.FileM3UID, xepgChannel.XGroupTitle, xepgChannel.XBufferProfile),
+			TimeShift:      getTimeShift(xepgChannel.XTimeShift),
+		}
+
+		channels[streamInfo.PlaylistID+getStreamMD5(streamInfo.URL, "")] = streamInfo
+
+	}
+
+	warmChannelsMutex.Lock()
+	warmChannels = channels
+	warmChannelsMutex.Unlock()
+
+}
+
+// startWarmStream : Starts the upstream of a warm channel without clients, only with a free tuner
+func startWarmStream(streamInfo StreamInfo) {
+
+	var playlistID = streamInfo.PlaylistID
+	var tunerKey = playlistID + getStreamMD5(streamInfo.URL, "")
+
+	if len(getPlaylistType(playlistID)) == 0 {
+		return
+	}
+
+	Lock.Lock()
+
+	var playlist *Playlist
+	if p, ok := BufferInformation.Load(playlistID); ok {
+		playlist = p.(*Playlist)
+	} else {
+		playlist = newBufferPlaylist(playlistID)
+	}
+
+	// No stream can be stopped for a warm stream
+	if !tuners.Acquire(playlistID, tunerKey, streamInfo.Name, tunerWarmPriority) {
+		Lock.Unlock()
+		return
+	}
+
+	var streamID = createStreamID(playlist.Streams, "keep-warm", streamInfo.URL)
+
+	var stream = newBufferStream(playlist, streamInfo.URL, "", streamInfo.BackupChannels, streamInfo.Name, streamInfo.BufferProfile, streamInfo.TimeShift)
+	stream.Warm = true
+
+	playlist.Streams[streamID] = stream
+	playlist.Clients[streamID] = ThisClient{Connection: 0}
+	BufferInformation.Store(playlistID, playlist)
+
+	showInfo(fmt.Sprintf("Keep Warm:Channel: %s - Starting upstream (Tuner: %d / %d)", streamInfo.Name, len(playlist.Streams), playlist.Tuner))
+
+	Lock.Unlock()
+
+	go startBuffer(streamID, playlistID)
+	go watchWarmStream(playlistID, streamID, stream)
+
+}
+
+// watchWarmStream : Removes a warm stream without clients when its buffer is closed (tuner taken over, upstream failed, x-keep-warm disabled).
+// Streams with clients are removed by the last client.
+func watchWarmStream(playlistID string, streamID int, stream *ThisStream) {
+
+	<-stream.buffer.Done()
+
+	if removeIdleStream(playlistID, streamID, stream) != nil {
+		showInfo(fmt.Sprintf("Keep Warm:Channel: %s - Upstream stopped", stream.ChannelName))
+	}
+
+}
+
+// getStreamConnections : Number of clients of a stream
+func getStreamConnections(playlistID string, streamID int) (connections int) {
+
+	Lock.RLock()
+	defer Lock.RUnlock()
+
+	if p, ok := BufferInformation.Load(playlistID); ok {
+		connections = p.(*Playlist).Clients[streamID].Connection
+	}
+
+	return
+}
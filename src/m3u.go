@@ -182,7 +182,7 @@ func checkConditions(streamValues, conditions, coType string) (status bool) {
 	return
 }
 
-func buildM3U(groups []string) (m3u string, err error) {
+func buildM3U(groups []string, user string) (m3u string, err error) {
 
 	var imgc = Data.Cache.Images
 	var m3uChannels = make(map[float64]XEPGChannelStruct)
@@ -255,7 +255,7 @@ func buildM3U(groups []string) (m3u string, err error) {
 			logo = imgc.Image.GetURL(channel.TvgLogo, Settings.HttpThreadfinDomain, Settings.Port, Settings.ForceHttps, Settings.HttpsPort, Settings.HttpsThreadfinDomain)
 		}
 		var parameter = fmt.Sprintf(`#EXTINF:0 channelID="%s" tvg-chno="%s" tvg-name="%s" tvg-id="%s" tvg-logo="%s" group-title="%s",%s`+"\n", channel.XEPG, channel.XChannelID, channel.XName, channel.XChannelID, logo, group, channel.XName)
-		var stream, err = createStreamingURL("M3U", channel.FileM3UID, channel.XChannelID, channel.XName, channel.URL, channel.BackupChannel1, channel.BackupChannel2, channel.BackupChannel3)
+		var stream, err = createStreamingURL("M3U", channel.FileM3UID, channel.XChannelID, channel.XName, channel.URL, channel.BackupChannels, getBufferProfileName(channel.FileM3UID, channel.XGroupTitle, channel.XBufferProfile), getTimeShift(channel.XTimeShift), user)
 		if err == nil {
 			// Check for exact duplicate of the entire channel entry
 			channelEntry := parameter + stream + "\n"
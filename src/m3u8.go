@@ -0,0 +1,538 @@
+package src
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// hlsPlaylist : Master playlist (variants) or media playlist (segments) of an HLS stream
+type hlsPlaylist struct {
+	Variants       map[int]DynamicStream
+	Segments       []Segment
+	TargetDuration float64
+	MediaSequence  int64
+	Discontinuity  int64 // EXT-X-DISCONTINUITY-SEQUENCE
+	Ended          bool
+	Encrypted      bool
+	Fragmented     bool
+}
+
+// hlsIngest : Downloads the segments of an HLS stream in order and writes them as continuous MPEG-TS into a pipe, which is read by the native backend
+type hlsIngest struct {
+	backend  *nativeBackend
+	url      string
+	variants map[int]DynamicStream
+	variant  DynamicStream
+	sequence int64 // Sequence of the last downloaded segment, -1 before the first segment
+	measured int   // Download bandwidth of the segments (bit/s, average)
+
+	// Media and discontinuity sequence of the last playlist, they only decrease if the server has restarted the stream
+	mediaSequence int64
+	discontinuity int64
+
+	reader *io.PipeReader
+	writer *io.PipeWriter
+
+	// Target duration of the media playlist, the segments arrive in this interval
+	targetDuration atomic.Int64
+}
+
+// Attempts to download a playlist or a segment before it is skipped
+const hlsRetries = 3
+
+// Wait time between two attempts
+const hlsRetryDelay = time.Second
+
+// Segments a live stream starts before the end of the playlist
+const hlsLiveSegments = 3
+
+// Maximum size of an M3U8 playlist
+const hlsPlaylistLimit = 1024 * 1024
+
+// Share of the measured download bandwidth that a variant may use, the rest is reserved for fluctuations
+const hlsBandwidthHeadroom = 0.8
+
+// isM3U8 : The response of the streaming server is an HLS playlist
+func isM3U8(resp *http.Response) bool {
+
+	var contentType = strings.ToLower(resp.Header.Get("Content-Type"))
+
+	if strings.Contains(contentType, "mpegurl") {
+		return true
+	}
+
+	return strings.HasSuffix(strings.ToLower(resp.Request.URL.Path), ".m3u8")
+}
+
+// newHLSIngest : Starts the download of the HLS stream. The first playlist has already been downloaded by the native backend.
+func newHLSIngest(backend *nativeBackend, playlistURL *url.URL, body []byte) (ingest *hlsIngest, err error) {
+
+	playlist, err := parseM3U8(string(body), playlistURL)
+	if err != nil {
+		return
+	}
+
+	ingest = &hlsIngest{backend: backend, url: playlistURL.String(), sequence: -1}
+	ingest.reader, ingest.writer = io.Pipe()
+
+	go func() {
+		ingest.writer.CloseWithError(ingest.run(&playlist))
+	}()
+
+	return
+}
+
+// run : Reloads the media playlist and downloads the new segments until the backend is stopped or the stream has ended
+func (h *hlsIngest) run(playlist *hlsPlaylist) (err error) {
+
+	var ctx = h.backend.ctx
+	var failed int // Segments in a row that could not be downloaded
+
+	for {
+
+		var loaded = time.Now()
+
+		if playlist == nil {
+
+			var p hlsPlaylist
+			if p, err = h.loadPlaylist(ctx); err != nil {
+				return
+			}
+
+			playlist = &p
+
+		}
+
+		// Master playlist: The variant is selected by the bandwidth, the media playlist is loaded
+		if len(playlist.Variants) > 0 {
+
+			if h.variants != nil {
+				return errors.New(getErrMsg(4050))
+			}
+
+			h.variants = playlist.Variants
+
+			if err = h.selectVariant(); err != nil {
+				return
+			}
+
+			playlist = nil
+			continue
+		}
+
+		if playlist.Encrypted {
+			return errors.New("Encrypted HLS streams are not supported by the Threadfin buffer, use FFmpeg")
+		}
+
+		if playlist.Fragmented {
+			return errors.New("HLS streams with fMP4 segments are not supported by the Threadfin buffer, use FFmpeg")
+		}
+
+		var segments = playlist.Segments
+
+		h.targetDuration.Store(int64(playlist.TargetDuration * float64(time.Second)))
+
+		// The server has restarted the numbering of the segments (e.g. restart of the encoder), the download continues at the live edge
+		if h.sequence >= 0 && len(segments) > 0 && (playlist.MediaSequence < h.mediaSequence || playlist.Discontinuity < h.discontinuity || segments[len(segments)-1].Sequence < h.sequence) {
+			showInfo(fmt.Sprintf("HLS:Media sequence was reset (%d -> %d), continuing at the live edge", h.sequence, segments[len(segments)-1].Sequence))
+			h.sequence = -1
+		}
+
+		h.mediaSequence = playlist.MediaSequence
+		h.discontinuity = playlist.Discontinuity
+
+		// Live streams start a few segments before the end of the playlist
+		if h.sequence < 0 && !playlist.Ended && len(segments) > hlsLiveSegments {
+			segments = segments[len(segments)-hlsLiveSegments:]
+		}
+
+		var downloaded int
+
+		for _, segment := range segments {
+
+			if segment.Sequence <= h.sequence {
+				continue
+			}
+
+			if err = h.downloadSegment(ctx, segment); err != nil {
+
+				if ctx.Err() != nil {
+					return
+				}
+
+				failed++
+				showDebug(fmt.Sprintf("HLS:Segment %d skipped (%s)", segment.Sequence, err.Error()), 1)
+
+				if failed >= hlsRetries {
+					return
+				}
+
+			} else {
+				failed = 0
+			}
+
+			h.sequence = segment.Sequence
+			downloaded++
+
+		}
+
+		if playlist.Ended {
+			return io.EOF
+		}
+
+		// The bandwidth was measured with the new segments, a different variant may be used from now on
+		if downloaded > 0 && len(h.variants) > 1 {
+
+			if err = h.selectVariant(); err != nil {
+				return
+			}
+
+		}
+
+		// A changed playlist is reloaded after the target duration, an unchanged one after half of it
+		var reload = time.Duration(playlist.TargetDuration * float64(time.Second))
+		if reload <= 0 {
+			reload = time.Second
+		}
+
+		if downloaded == 0 {
+			reload /= 2
+		}
+
+		select {
+
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-time.After(time.Until(loaded.Add(reload))):
+
+		}
+
+		playlist = nil
+
+	}
+
+}
+
+// StallTimeout : Time without new data after which the stream is stalled, two target durations of the playlist.
+// The segments are downloaded at once, between them no data arrives until the playlist is reloaded.
+func (h *hlsIngest) StallTimeout() time.Duration {
+	return time.Duration(h.targetDuration.Load()) * 2
+}
+
+// selectVariant : Variant with the highest bandwidth below the measured bandwidth and the configured limit (m3u8.adaptive.bandwidth.mbps)
+func (h *hlsIngest) selectVariant() (err error) {
+
+	var limit = Settings.M3U8AdaptiveBandwidthMBPS * 1000 * 1000
+
+	if measured := int(float64(h.measured) * hlsBandwidthHeadroom); measured > 0 && (limit <= 0 || measured < limit) {
+		limit = measured
+	}
+
+	variant, err := switchBandwidth(h.variants, limit)
+	if err != nil {
+		return
+	}
+
+	if variant.URL != h.variant.URL {
+
+		var info = formatBitrate(variant.Bandwidth)
+		if len(variant.Resolution) > 0 {
+			info = variant.Resolution + ", " + info
+		}
+
+		showInfo(fmt.Sprintf("HLS:Variant %s", info))
+
+		h.variant = variant
+		h.url = variant.URL
+
+	}
+
+	return
+}
+
+// loadPlaylist : Downloads and parses the current playlist
+func (h *hlsIngest) loadPlaylist(ctx context.Context) (playlist hlsPlaylist, err error) {
+
+	for attempt := 1; attempt <= hlsRetries; attempt++ {
+
+		var body []byte
+		var base *url.URL
+
+		if body, base, err = h.get(ctx, h.url, hlsPlaylistLimit); err == nil {
+
+			if playlist, err = parseM3U8(string(body), base); err == nil {
+				return
+			}
+
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		showDebug(fmt.Sprintf("HLS:Playlist could not be loaded (%s), attempt %d / %d", err.Error(), attempt, hlsRetries), 1)
+
+		if !sleepContext(ctx, hlsRetryDelay) {
+			return playlist, ctx.Err()
+		}
+
+	}
+
+	return
+}
+
+// downloadSegment : Downloads the segment and writes it into the pipe. The segment is downloaded completely, so that an attempt can be repeated.
+func (h *hlsIngest) downloadSegment(ctx context.Context, segment Segment) (err error) {
+
+	for attempt := 1; attempt <= hlsRetries; attempt++ {
+
+		var start = time.Now()
+		var data []byte
+
+		if data, _, err = h.get(ctx, segment.URL, -1); err == nil {
+
+			if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+
+				var bitrate = int(float64(len(data)) * 8 / elapsed)
+
+				if h.measured == 0 {
+					h.measured = bitrate
+				} else {
+					h.measured = (h.measured + bitrate) / 2
+				}
+
+			}
+
+			_, err = h.writer.Write(data)
+			return
+		}
+
+		if ctx.Err() != nil || attempt == hlsRetries {
+			return
+		}
+
+		showDebug(fmt.Sprintf("HLS:Segment %d could not be loaded (%s), attempt %d / %d", segment.Sequence, err.Error(), attempt, hlsRetries), 2)
+
+		if !sleepContext(ctx, hlsRetryDelay) {
+			return ctx.Err()
+		}
+
+	}
+
+	return
+}
+
+// get : Downloads a file with the headers and the proxy of the playlist. Returns the URL after redirects, relative URLs of a playlist refer to it.
+func (h *hlsIngest) get(ctx context.Context, fileURL string, limit int64) (data []byte, location *url.URL, err error) {
+
+	ctx, cancel := context.WithTimeout(ctx, h.backend.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fileURL, nil)
+	if err != nil {
+		return
+	}
+
+	req.Header = h.backend.headers.Clone()
+
+	resp, err := h.backend.client.Do(req)
+	if err != nil {
+		return
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("%d: %s (%s)", resp.StatusCode, http.StatusText(resp.StatusCode), getErrMsg(4004))
+		return
+	}
+
+	var body io.Reader = resp.Body
+	if limit > 0 {
+		body = io.LimitReader(resp.Body, limit)
+	}
+
+	data, err = io.ReadAll(body)
+	location = resp.Request.URL
+
+	return
+}
+
+// parseM3U8 : Parses a master or media playlist, the URLs are resolved relative to the URL of the playlist
+func parseM3U8(content string, base *url.URL) (playlist hlsPlaylist, err error) {
+
+	var scanner = bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), hlsPlaylistLimit)
+
+	var header bool
+	var streamInf map[string]string
+	var duration float64
+	var index int64
+
+	for scanner.Scan() {
+
+		var line = strings.TrimSpace(scanner.Text())
+
+		if len(line) == 0 {
+			continue
+		}
+
+		if !header {
+
+			if !strings.HasPrefix(line, "#EXTM3U") {
+				err = errors.New(getErrMsg(4051))
+				return
+			}
+
+			header = true
+			continue
+		}
+
+		switch {
+
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			streamInf = parseM3U8Attributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			playlist.TargetDuration, _ = strconv.ParseFloat(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"), 64)
+
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			playlist.MediaSequence, _ = strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+
+		case strings.HasPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"):
+			playlist.Discontinuity, _ = strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"), 10, 64)
+
+		case strings.HasPrefix(line, "#EXTINF:"):
+			var value = strings.TrimPrefix(line, "#EXTINF:")
+			duration, _ = strconv.ParseFloat(strings.SplitN(value, ",", 2)[0], 64)
+
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			if method := parseM3U8Attributes(strings.TrimPrefix(line, "#EXT-X-KEY:"))["METHOD"]; method != "NONE" {
+				playlist.Encrypted = true
+			}
+
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			playlist.Fragmented = true
+
+		case strings.HasPrefix(line, "#EXT-X-ENDLIST"):
+			playlist.Ended = true
+
+		case strings.HasPrefix(line, "#"):
+			continue
+
+		default:
+
+			uri, e := base.Parse(line)
+			if e != nil {
+				err = fmt.Errorf("%s (%s)", getErrMsg(4050), e.Error())
+				return
+			}
+
+			// Variant of a master playlist
+			if streamInf != nil {
+
+				var variant = DynamicStream{URL: uri.String(), Resolution: streamInf["RESOLUTION"]}
+				variant.Bandwidth, _ = strconv.Atoi(streamInf["BANDWIDTH"])
+				variant.AverageBandwidth, _ = strconv.Atoi(streamInf["AVERAGE-BANDWIDTH"])
+				variant.Framerate, _ = strconv.ParseFloat(streamInf["FRAME-RATE"], 64)
+
+				if playlist.Variants == nil {
+					playlist.Variants = make(map[int]DynamicStream)
+				}
+
+				if _, ok := playlist.Variants[variant.Bandwidth]; !ok {
+					playlist.Variants[variant.Bandwidth] = variant
+				}
+
+				streamInf = nil
+				continue
+			}
+
+			// Segment of a media playlist
+			playlist.Segments = append(playlist.Segments, Segment{Duration: duration, Sequence: playlist.MediaSequence + index, URL: uri.String()})
+			duration = 0
+			index++
+
+		}
+
+	}
+
+	if err = scanner.Err(); err != nil {
+		return
+	}
+
+	if !header {
+		err = errors.New(getErrMsg(4051))
+	}
+
+	return
+}
+
+// parseM3U8Attributes : Attribute list of an M3U8 tag (BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2")
+func parseM3U8Attributes(list string) (attributes map[string]string) {
+
+	attributes = make(map[string]string)
+
+	for len(list) > 0 {
+
+		var i = strings.IndexByte(list, '=')
+		if i < 0 {
+			break
+		}
+
+		var key = strings.TrimSpace(list[:i])
+		var value string
+		list = list[i+1:]
+
+		if strings.HasPrefix(list, `"`) {
+
+			var end = strings.IndexByte(list[1:], '"')
+			if end < 0 {
+				value, list = list[1:], ""
+			} else {
+				value, list = list[1:end+1], list[end+2:]
+			}
+
+		} else {
+
+			var end = strings.IndexByte(list, ',')
+			if end < 0 {
+				value, list = list, ""
+			} else {
+				value, list = list[:end], list[end:]
+			}
+
+		}
+
+		attributes[key] = value
+		list = strings.TrimPrefix(list, ",")
+
+	}
+
+	return
+}
+
+// sleepContext : Waits for the duration, false if the context was cancelled before
+func sleepContext(ctx context.Context, duration time.Duration) bool {
+
+	select {
+
+	case <-ctx.Done():
+		return false
+
+	case <-time.After(duration):
+		return true
+
+	}
+
+}
@@ -0,0 +1,201 @@
+package src
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseM3U8(t *testing.T) {
+
+	var base, _ = url.Parse("http://provider.example/live/channel/index.m3u8?token=1")
+
+	var tests = []struct {
+		name     string
+		content  string
+		err      bool
+		variants map[int]DynamicStream
+		segments []Segment
+		playlist hlsPlaylist // Only the flags and sequences are compared
+	}{
+		{
+			name: "master playlist",
+			content: "#EXTM3U\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\n" +
+				"low/index.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=5000000,AVERAGE-BANDWIDTH=4500000,RESOLUTION=1280x720,FRAME-RATE=50.000,CODECS=\"avc1.4d401f,mp4a.40.2\"\n" +
+				"http://cdn.example/high.m3u8\n",
+			variants: map[int]DynamicStream{
+				800000:  {URL: "http://provider.example/live/channel/low/index.m3u8", Bandwidth: 800000, Resolution: "640x360"},
+				5000000: {URL: "http://cdn.example/high.m3u8", Bandwidth: 5000000, AverageBandwidth: 4500000, Resolution: "1280x720", Framerate: 50},
+			},
+		},
+		{
+			name: "master playlist with the same bandwidth twice",
+			content: "#EXTM3U\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=800000\n" +
+				"first.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=800000\n" +
+				"second.m3u8\n",
+			variants: map[int]DynamicStream{
+				800000: {URL: "http://provider.example/live/channel/first.m3u8", Bandwidth: 800000},
+			},
+		},
+		{
+			name: "live media playlist",
+			content: "#EXTM3U\n" +
+				"#EXT-X-VERSION:3\n" +
+				"#EXT-X-TARGETDURATION:6\n" +
+				"#EXT-X-MEDIA-SEQUENCE:100\n" +
+				"#EXT-X-DISCONTINUITY-SEQUENCE:4\n" +
+				"\n" +
+				"#EXTINF:6.006,\n" +
+				"100.ts\n" +
+				"#EXTINF:5.5,Title\n" +
+				"/segments/101.ts\n",
+			segments: []Segment{
+				{Duration: 6.006, Sequence: 100, URL: "http://provider.example/live/channel/100.ts"},
+				{Duration: 5.5, Sequence: 101, URL: "http://provider.example/segments/101.ts"},
+			},
+			playlist: hlsPlaylist{TargetDuration: 6, MediaSequence: 100, Discontinuity: 4},
+		},
+		{
+			name: "ended media playlist",
+			content: "#EXTM3U\n" +
+				"#EXT-X-TARGETDURATION:10\n" +
+				"#EXTINF:10,\n" +
+				"0.ts\n" +
+				"#EXT-X-ENDLIST\n",
+			segments: []Segment{
+				{Duration: 10, Sequence: 0, URL: "http://provider.example/live/channel/0.ts"},
+			},
+			playlist: hlsPlaylist{TargetDuration: 10, Ended: true},
+		},
+		{
+			name: "encrypted media playlist",
+			content: "#EXTM3U\n" +
+				"#EXT-X-KEY:METHOD=AES-128,URI=\"key.bin\"\n" +
+				"#EXTINF:4,\n" +
+				"0.ts\n",
+			segments: []Segment{
+				{Duration: 4, Sequence: 0, URL: "http://provider.example/live/channel/0.ts"},
+			},
+			playlist: hlsPlaylist{Encrypted: true},
+		},
+		{
+			name: "unencrypted key tag",
+			content: "#EXTM3U\n" +
+				"#EXT-X-KEY:METHOD=NONE\n" +
+				"#EXTINF:4,\n" +
+				"0.ts\n",
+			segments: []Segment{
+				{Duration: 4, Sequence: 0, URL: "http://provider.example/live/channel/0.ts"},
+			},
+		},
+		{
+			name: "fragmented media playlist",
+			content: "#EXTM3U\n" +
+				"#EXT-X-MAP:URI=\"init.mp4\"\n" +
+				"#EXTINF:4,\n" +
+				"0.m4s\n",
+			segments: []Segment{
+				{Duration: 4, Sequence: 0, URL: "http://provider.example/live/channel/0.m4s"},
+			},
+			playlist: hlsPlaylist{Fragmented: true},
+		},
+		{
+			name:    "missing header",
+			content: "#EXTINF:4,\n0.ts\n",
+			err:     true,
+		},
+		{
+			name:    "empty",
+			content: "",
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			playlist, err := parseM3U8(test.content, base)
+
+			if test.err {
+
+				if err == nil {
+					t.Fatalf("parseM3U8() error = nil, want an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseM3U8() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(playlist.Variants, test.variants) {
+				t.Errorf("Variants = %+v, want %+v", playlist.Variants, test.variants)
+			}
+
+			if !reflect.DeepEqual(playlist.Segments, test.segments) {
+				t.Errorf("Segments = %+v, want %+v", playlist.Segments, test.segments)
+			}
+
+			playlist.Variants, playlist.Segments = nil, nil
+
+			if !reflect.DeepEqual(playlist, test.playlist) {
+				t.Errorf("playlist = %+v, want %+v", playlist, test.playlist)
+			}
+
+		})
+
+	}
+
+}
+
+func TestParseM3U8Attributes(t *testing.T) {
+
+	var tests = []struct {
+		list       string
+		attributes map[string]string
+	}{
+		{
+			list:       "BANDWIDTH=1280000,RESOLUTION=1280x720",
+			attributes: map[string]string{"BANDWIDTH": "1280000", "RESOLUTION": "1280x720"},
+		},
+		{
+			list:       `BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2",FRAME-RATE=25`,
+			attributes: map[string]string{"BANDWIDTH": "1280000", "CODECS": "avc1.4d401f,mp4a.40.2", "FRAME-RATE": "25"},
+		},
+		{
+			list:       `METHOD=AES-128,URI="https://keys.example/key?a=1,b=2"`,
+			attributes: map[string]string{"METHOD": "AES-128", "URI": "https://keys.example/key?a=1,b=2"},
+		},
+		{
+			list:       ` BANDWIDTH=1, RESOLUTION=640x360`,
+			attributes: map[string]string{"BANDWIDTH": "1", "RESOLUTION": "640x360"},
+		},
+		{
+			list:       `URI="unterminated`,
+			attributes: map[string]string{"URI": "unterminated"},
+		},
+		{
+			list:       "",
+			attributes: map[string]string{},
+		},
+		{
+			list:       "NOVALUE",
+			attributes: map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+
+		if attributes := parseM3U8Attributes(test.list); !reflect.DeepEqual(attributes, test.attributes) {
+			t.Errorf("parseM3U8Attributes(%q) = %v, want %v", test.list, attributes, test.attributes)
+		}
+
+	}
+
+}
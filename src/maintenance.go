@@ -13,6 +13,8 @@ func InitMaintenance() (err error) {
 	System.TimeForAutoUpdate = fmt.Sprintf("0%d%d", randomTime(0, 2), randomTime(10, 59))
 
 	go maintenance()
+	go scheduleRecordings()
+	go keepWarm()
 
 	return
 }
@@ -0,0 +1,259 @@
+package src
+
+import (
+	"bytes"
+)
+
+// tsParser : Analyzes the MPEG-TS packets of a stream. It caches the program tables (PAT / PMT) and detects
+// the packets with which a client can start to decode the video (random access points, keyframes).
+type tsParser struct {
+	pmtPID    int
+	videoPID  int
+	videoType byte
+
+	pat []byte
+	pmt []byte
+}
+
+// PIDs of the program tables
+const (
+	tsPIDPAT  = 0x0000
+	tsPIDNone = -1
+)
+
+// Stream types of the video codecs in the PMT
+const (
+	tsStreamMPEG1 = 0x01
+	tsStreamMPEG2 = 0x02
+	tsStreamH264  = 0x1b
+	tsStreamHEVC  = 0x24
+)
+
+func newTSParser() *tsParser {
+	return &tsParser{pmtPID: tsPIDNone, videoPID: tsPIDNone}
+}
+
+// Packet : Analyzes the next packet. keyframe: The video can be decoded from this packet on, tables: PAT or PMT have changed.
+func (p *tsParser) Packet(packet []byte) (keyframe, tables bool) {
+
+	if len(packet) < tsPacketSize || packet[0] != tsSyncByte {
+		return
+	}
+
+	var pid = int(packet[1]&0x1f)<<8 | int(packet[2])
+	var start = packet[1]&0x40 != 0 // Payload unit start indicator
+
+	if !start {
+		return
+	}
+
+	var payload = tsPayload(packet)
+	if payload == nil {
+		return
+	}
+
+	switch pid {
+
+	case tsPIDPAT:
+		return false, p.parsePAT(packet, payload)
+
+	case p.pmtPID:
+		return false, p.parsePMT(packet, payload)
+
+	case p.videoPID:
+		return p.isKeyframe(packet, payload), false
+
+	}
+
+	return
+}
+
+// Tables : PAT and PMT of the stream, nil until both are known
+func (p *tsParser) Tables() (tables []byte) {
+
+	if p.pat == nil || p.pmt == nil {
+		return nil
+	}
+
+	tables = make([]byte, 0, 2*tsPacketSize)
+	tables = append(tables, p.pat...)
+	tables = append(tables, p.pmt...)
+
+	return
+}
+
+// parsePAT : PID of the PMT of the first program
+func (p *tsParser) parsePAT(packet, payload []byte) (changed bool) {
+
+	var section = tsSection(payload, 0x00)
+	if section == nil {
+		return
+	}
+
+	for i := 8; i+4 <= len(section)-4; i += 4 {
+
+		var program = int(section[i])<<8 | int(section[i+1])
+		var pid = int(section[i+2]&0x1f)<<8 | int(section[i+3])
+
+		// Program 0 is the network information table
+		if program == 0 {
+			continue
+		}
+
+		if pid != p.pmtPID {
+			p.pmtPID = pid
+			p.videoPID = tsPIDNone
+			p.pmt = nil
+		}
+
+		break
+	}
+
+	return p.cache(&p.pat, packet)
+}
+
+// parsePMT : PID and codec of the first video stream
+func (p *tsParser) parsePMT(packet, payload []byte) (changed bool) {
+
+	var section = tsSection(payload, 0x02)
+	if section == nil || len(section) < 12 {
+		return
+	}
+
+	var end = len(section) - 4 // CRC
+	var i = 12 + (int(section[10]&0x0f)<<8 | int(section[11]))
+
+	p.videoPID = tsPIDNone
+
+	for ; i+5 <= end; i += 5 + (int(section[i+3]&0x0f)<<8 | int(section[i+4])) {
+
+		var streamType = section[i]
+		var pid = int(section[i+1]&0x1f)<<8 | int(section[i+2])
+
+		switch streamType {
+
+		case tsStreamMPEG1, tsStreamMPEG2, tsStreamH264, tsStreamHEVC:
+			p.videoPID = pid
+			p.videoType = streamType
+			return p.cache(&p.pmt, packet)
+
+		}
+
+	}
+
+	return p.cache(&p.pmt, packet)
+}
+
+// cache : Stores a copy of the table packet, true if the content has changed. The continuity counter is not compared.
+func (p *tsParser) cache(table *[]byte, packet []byte) (changed bool) {
+
+	if *table != nil && bytes.Equal((*table)[1:3], packet[1:3]) && bytes.Equal((*table)[4:], packet[4:]) {
+		return false
+	}
+
+	*table = append([]byte(nil), packet[:tsPacketSize]...)
+
+	return true
+}
+
+// isKeyframe : The packet starts a video frame that can be decoded without previous frames.
+// The random access indicator is used if the muxer sets it, otherwise the start codes of the video are checked.
+func (p *tsParser) isKeyframe(packet, payload []byte) bool {
+
+	// Adaptation field with random access indicator
+	if packet[3]&0x20 != 0 && packet[4] > 0 && packet[5]&0x40 != 0 {
+		return true
+	}
+
+	// PES header
+	if len(payload) < 9 || payload[0] != 0 || payload[1] != 0 || payload[2] != 1 {
+		return false
+	}
+
+	var data = payload[9:]
+	if int(payload[8]) > len(data) {
+		return false
+	}
+
+	data = data[payload[8]:]
+
+	for i := 0; i+3 < len(data); i++ {
+
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			continue
+		}
+
+		var code = data[i+3]
+
+		switch p.videoType {
+
+		case tsStreamH264:
+			// IDR slice or sequence parameter set
+			if nal := code & 0x1f; nal == 5 || nal == 7 {
+				return true
+			}
+
+		case tsStreamHEVC:
+			// IRAP picture, video or sequence parameter set
+			if nal := (code >> 1) & 0x3f; (nal >= 16 && nal <= 21) || nal == 32 || nal == 33 {
+				return true
+			}
+
+		case tsStreamMPEG1, tsStreamMPEG2:
+			// Sequence header or group of pictures
+			if code == 0xb3 || code == 0xb8 {
+				return true
+			}
+
+		}
+
+	}
+
+	return false
+}
+
+// tsPayload : Payload of a packet without the adaptation field, nil if the packet has no payload
+func tsPayload(packet []byte) []byte {
+
+	var offset = 4
+
+	switch packet[3] & 0x30 {
+
+	case 0x10:
+
+	case 0x30:
+		offset += 1 + int(packet[4])
+
+	default:
+		return nil
+
+	}
+
+	if offset >= tsPacketSize {
+		return nil
+	}
+
+	return packet[offset:tsPacketSize]
+}
+
+// tsSection : Table section in the payload of a packet, only sections that fit into one packet are supported
+func tsSection(payload []byte, tableID byte) []byte {
+
+	if len(payload) < 1 {
+		return nil
+	}
+
+	var offset = 1 + int(payload[0]) // Pointer field
+	if offset+3 > len(payload) || payload[offset] != tableID {
+		return nil
+	}
+
+	var section = payload[offset:]
+	var length = 3 + (int(section[1]&0x0f)<<8 | int(section[2]))
+
+	if length > len(section) || length < 12 {
+		return nil
+	}
+
+	return section[:length]
+}
@@ -0,0 +1,238 @@
+package src
+
+import (
+	"bytes"
+	"testing"
+)
+
+// PIDs of the test stream
+const (
+	testPMTPID   = 0x1000
+	testVideoPID = 0x0100
+	testAudioPID = 0x0101
+)
+
+// newTestPacket : MPEG-TS packet with payload unit start indicator, the rest of the packet is filled with stuffing bytes
+func newTestPacket(pid int, adaptation []byte, payload []byte) []byte {
+
+	var packet = make([]byte, tsPacketSize)
+	for i := range packet {
+		packet[i] = 0xff
+	}
+
+	packet[0] = tsSyncByte
+	packet[1] = 0x40 | byte(pid>>8)&0x1f
+	packet[2] = byte(pid)
+	packet[3] = 0x10
+
+	var offset = 4
+
+	if adaptation != nil {
+		packet[3] = 0x30
+		packet[4] = byte(len(adaptation))
+		copy(packet[5:], adaptation)
+		offset += 1 + len(adaptation)
+	}
+
+	copy(packet[offset:], payload)
+
+	return packet
+}
+
+// newTestPAT : PAT with one program
+func newTestPAT(pmtPID int) []byte {
+
+	return newTestPacket(tsPIDPAT, nil, []byte{
+		0x00,             // Pointer field
+		0x00, 0xb0, 0x0d, // Table ID, section length
+		0x00, 0x01, 0xc1, 0x00, 0x00, // Transport stream ID, version, section numbers
+		0x00, 0x01, 0xe0 | byte(pmtPID>>8), byte(pmtPID), // Program 1
+		0x00, 0x00, 0x00, 0x00, // CRC
+	})
+
+}
+
+// newTestPMT : PMT with one elementary stream
+func newTestPMT(streamType byte, pid int) []byte {
+
+	return newTestPacket(testPMTPID, nil, []byte{
+		0x00,             // Pointer field
+		0x02, 0xb0, 0x12, // Table ID, section length
+		0x00, 0x01, 0xc1, 0x00, 0x00, // Program number, version, section numbers
+		0xe0 | byte(pid>>8), byte(pid), // PCR PID
+		0xf0, 0x00, // Program info length
+		streamType, 0xe0 | byte(pid>>8), byte(pid), 0xf0, 0x00, // Elementary stream
+		0x00, 0x00, 0x00, 0x00, // CRC
+	})
+
+}
+
+// newTestPES : Packet with the start of a PES packet, data follows the PES header
+func newTestPES(pid int, randomAccess bool, data ...byte) []byte {
+
+	var adaptation []byte
+	if randomAccess {
+		adaptation = []byte{0x40}
+	}
+
+	var payload = append([]byte{0x00, 0x00, 0x01, 0xe0, 0x00, 0x00, 0x80, 0x00, 0x00}, data...)
+
+	return newTestPacket(pid, adaptation, payload)
+}
+
+func TestTSParserKeyframe(t *testing.T) {
+
+	var tests = []struct {
+		name     string
+		packets  [][]byte
+		keyframe bool
+	}{
+		{
+			name:     "H.264 IDR slice",
+			packets:  [][]byte{newTestPAT(testPMTPID), newTestPMT(tsStreamH264, testVideoPID), newTestPES(testVideoPID, false, 0x00, 0x00, 0x00, 0x01, 0x09, 0xf0, 0x00, 0x00, 0x01, 0x65)},
+			keyframe: true,
+		},
+		{
+			name:     "H.264 sequence parameter set",
+			packets:  [][]byte{newTestPAT(testPMTPID), newTestPMT(tsStreamH264, testVideoPID), newTestPES(testVideoPID, false, 0x00, 0x00, 0x01, 0x67)},
+			keyframe: true,
+		},
+		{
+			name:     "H.264 non-IDR slice",
+			packets:  [][]byte{newTestPAT(testPMTPID), newTestPMT(tsStreamH264, testVideoPID), newTestPES(testVideoPID, false, 0x00, 0x00, 0x01, 0x41)},
+			keyframe: false,
+		},
+		{
+			name:     "random access indicator",
+			packets:  [][]byte{newTestPAT(testPMTPID), newTestPMT(tsStreamH264, testVideoPID), newTestPES(testVideoPID, true, 0x00, 0x00, 0x01, 0x41)},
+			keyframe: true,
+		},
+		{
+			name:     "HEVC IDR picture",
+			packets:  [][]byte{newTestPAT(testPMTPID), newTestPMT(tsStreamHEVC, testVideoPID), newTestPES(testVideoPID, false, 0x00, 0x00, 0x01, 0x26, 0x01)},
+			keyframe: true,
+		},
+		{
+			name:     "HEVC trailing picture",
+			packets:  [][]byte{newTestPAT(testPMTPID), newTestPMT(tsStreamHEVC, testVideoPID), newTestPES(testVideoPID, false, 0x00, 0x00, 0x01, 0x02, 0x01)},
+			keyframe: false,
+		},
+		{
+			name:     "MPEG-2 sequence header",
+			packets:  [][]byte{newTestPAT(testPMTPID), newTestPMT(tsStreamMPEG2, testVideoPID), newTestPES(testVideoPID, false, 0x00, 0x00, 0x01, 0xb3)},
+			keyframe: true,
+		},
+		{
+			name:     "MPEG-2 picture",
+			packets:  [][]byte{newTestPAT(testPMTPID), newTestPMT(tsStreamMPEG2, testVideoPID), newTestPES(testVideoPID, false, 0x00, 0x00, 0x01, 0x00)},
+			keyframe: false,
+		},
+		{
+			name:     "audio stream",
+			packets:  [][]byte{newTestPAT(testPMTPID), newTestPMT(tsStreamH264, testVideoPID), newTestPES(testAudioPID, true, 0x00, 0x00, 0x01, 0x65)},
+			keyframe: false,
+		},
+		{
+			name:     "video without PMT",
+			packets:  [][]byte{newTestPAT(testPMTPID), newTestPES(testVideoPID, true, 0x00, 0x00, 0x01, 0x65)},
+			keyframe: false,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			var parser = newTSParser()
+			var keyframe bool
+
+			for _, packet := range test.packets {
+				keyframe, _ = parser.Packet(packet)
+			}
+
+			if keyframe != test.keyframe {
+				t.Errorf("keyframe = %t, want %t", keyframe, test.keyframe)
+			}
+
+		})
+
+	}
+
+}
+
+func TestTSParserTables(t *testing.T) {
+
+	var pat = newTestPAT(testPMTPID)
+	var pmt = newTestPMT(tsStreamH264, testVideoPID)
+
+	// Same PAT with another continuity counter
+	var patRepeated = append([]byte(nil), pat...)
+	patRepeated[3] |= 0x05
+
+	var tests = []struct {
+		name    string
+		packets [][]byte
+		changed []bool
+		tables  bool
+	}{
+		{
+			name:    "PAT and PMT",
+			packets: [][]byte{pat, pmt},
+			changed: []bool{true, true},
+			tables:  true,
+		},
+		{
+			name:    "PAT only",
+			packets: [][]byte{pat},
+			changed: []bool{true},
+			tables:  false,
+		},
+		{
+			name:    "PMT before PAT",
+			packets: [][]byte{pmt, pat},
+			changed: []bool{false, true},
+			tables:  false,
+		},
+		{
+			name:    "repeated tables",
+			packets: [][]byte{pat, pmt, patRepeated, pmt},
+			changed: []bool{true, true, false, false},
+			tables:  true,
+		},
+		{
+			name:    "new PMT PID",
+			packets: [][]byte{pat, pmt, newTestPAT(0x1001)},
+			changed: []bool{true, true, true},
+			tables:  false,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			var parser = newTSParser()
+
+			for i, packet := range test.packets {
+
+				if _, changed := parser.Packet(packet); changed != test.changed[i] {
+					t.Errorf("packet %d: tables changed = %t, want %t", i, changed, test.changed[i])
+				}
+
+			}
+
+			var tables = parser.Tables()
+
+			if (tables != nil) != test.tables {
+				t.Fatalf("Tables() = %d bytes, want tables: %t", len(tables), test.tables)
+			}
+
+			if tables != nil && !bytes.Equal(tables, append(append([]byte(nil), pat...), pmt...)) {
+				t.Errorf("Tables() does not contain the PAT and the PMT")
+			}
+
+		})
+
+	}
+
+}
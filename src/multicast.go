@@ -0,0 +1,301 @@
+package src
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/ipv4"
+)
+
+// multicastBackend : Receives an MPEG-TS stream (raw UDP or RTP) from a multicast group without UDPxy.
+// The group is joined when the backend starts and left when it is stopped, i.e. when the last client of the stream disconnects.
+type multicastBackend struct {
+	url    string
+	group  *net.UDPAddr
+	source net.IP // Source of a source-specific multicast stream (udp://source@group:port), packets of other senders are dropped
+	iface  *net.Interface
+
+	conn     *net.UDPConn
+	packets  *ipv4.PacketConn // IPv4 groups: Packets of other groups with the same port are dropped
+	packet   []byte
+	pending  []byte
+	sequence int // Sequence number of the last RTP packet, -1 before the first packet
+	lost     int
+
+	err   error
+	stop  sync.Once
+	mutex sync.Mutex
+}
+
+// Size of the receive buffer of the socket, a multicast stream can not be paused while the buffer is busy
+const multicastReadBuffer = 4 * 1024 * 1024
+
+// Maximum size of a UDP datagram
+const multicastPacketSize = 64 * 1024
+
+// isMulticastURL : Streaming URL of a multicast stream (udp://@239.0.0.1:1234, rtp://@239.0.0.1:5000)
+func isMulticastURL(streamingURL string) bool {
+	var scheme = strings.ToLower(strings.SplitN(streamingURL, "://", 2)[0])
+	return scheme == "udp" || scheme == "rtp"
+}
+
+func newMulticastBackend(streamingURL string) (backend *multicastBackend) {
+
+	backend = &multicastBackend{url: streamingURL, sequence: -1}
+
+	return
+}
+
+func (b *multicastBackend) Start() (err error) {
+
+	u, err := url.Parse(b.url)
+	if err != nil {
+		return
+	}
+
+	// udp://@group:port, the part before the @ is the source of the stream
+	if u.User != nil && len(u.User.Username()) > 0 {
+
+		if b.source = net.ParseIP(u.User.Username()); b.source == nil {
+			err = fmt.Errorf("Invalid multicast source: %s", u.User.Username())
+			return
+		}
+
+	}
+
+	b.group, err = net.ResolveUDPAddr("udp", u.Host)
+	if err != nil {
+		return
+	}
+
+	b.iface, err = getMulticastInterface(Settings.UDPInterface)
+	if err != nil {
+		return
+	}
+
+	var ifaceName = "default interface"
+	if b.iface != nil {
+		ifaceName = b.iface.Name
+	}
+
+	if b.group.IP.IsMulticast() {
+		showInfo(fmt.Sprintf("Multicast:Join %s (%s)", b.group.String(), ifaceName))
+		b.conn, err = net.ListenMulticastUDP("udp", b.iface, b.group)
+	} else {
+		showInfo(fmt.Sprintf("Multicast:%s is not a multicast address, listening for unicast packets", b.group.String()))
+		b.conn, err = net.ListenUDP("udp", b.group)
+	}
+
+	if err != nil {
+		return
+	}
+
+	if b.group.IP.IsMulticast() && b.group.IP.To4() != nil {
+		b.joinIPv4()
+	}
+
+	if err := b.conn.SetReadBuffer(multicastReadBuffer); err != nil {
+		showDebug(fmt.Sprintf("Multicast:Receive buffer could not be set (%s)", err.Error()), 2)
+	}
+
+	b.packet = make([]byte, multicastPacketSize)
+
+	return
+}
+
+func (b *multicastBackend) Read(p []byte) (n int, err error) {
+
+	for len(b.pending) == 0 {
+
+		var size int
+		var sender net.Addr
+		var destination net.IP
+
+		if b.packets != nil {
+
+			var cm *ipv4.ControlMessage
+
+			size, cm, sender, err = b.packets.ReadFrom(b.packet)
+			if cm != nil {
+				destination = cm.Dst
+			}
+
+		} else {
+			size, sender, err = b.conn.ReadFrom(b.packet)
+		}
+
+		if err != nil {
+
+			b.mutex.Lock()
+			if b.err == nil {
+				b.err = err
+			}
+			b.mutex.Unlock()
+
+			return
+		}
+
+		// The socket receives all packets for the port, also those of other groups that are joined by other streams
+		if destination != nil && !destination.Equal(b.group.IP) {
+			continue
+		}
+
+		if address, ok := sender.(*net.UDPAddr); b.source != nil && (!ok || !b.source.Equal(address.IP)) {
+			continue
+		}
+
+		b.pending = b.payload(b.packet[:size])
+
+	}
+
+	n = copy(p, b.pending)
+	b.pending = b.pending[n:]
+
+	return
+}
+
+// joinIPv4 : The destination address of every packet is checked, because the socket is bound to the port and not to the group.
+// Source-specific streams join the group only for their source. Without these options, the packets are only filtered by their sender.
+func (b *multicastBackend) joinIPv4() {
+
+	b.packets = ipv4.NewPacketConn(b.conn)
+
+	if err := b.packets.SetControlMessage(ipv4.FlagDst, true); err != nil {
+		showDebug(fmt.Sprintf("Multicast:The destination of the packets can not be checked (%s)", err.Error()), 2)
+	}
+
+	if b.source == nil {
+		return
+	}
+
+	var group = &net.UDPAddr{IP: b.group.IP}
+
+	if err := b.packets.LeaveGroup(b.iface, group); err != nil {
+		showDebug(fmt.Sprintf("Multicast:Source-specific join of %s is not possible (%s)", b.group.String(), err.Error()), 2)
+		return
+	}
+
+	if err := b.packets.JoinSourceSpecificGroup(b.iface, group, &net.UDPAddr{IP: b.source}); err != nil {
+
+		showDebug(fmt.Sprintf("Multicast:Source-specific join of %s is not possible (%s)", b.group.String(), err.Error()), 2)
+
+		if err := b.packets.JoinGroup(b.iface, group); err != nil {
+			ShowError(err, 0)
+		}
+
+		return
+	}
+
+	showInfo(fmt.Sprintf("Multicast:Join %s, source %s", b.group.String(), b.source.String()))
+
+}
+
+// payload : MPEG-TS data of the packet. RTP packets (RFC 3550) are detected by the version of the header, the header is removed.
+func (b *multicastBackend) payload(packet []byte) (data []byte) {
+
+	if len(packet) == 0 || packet[0] == tsSyncByte || packet[0]>>6 != 2 || len(packet) < 12 {
+		return packet
+	}
+
+	var offset = 12 + 4*int(packet[0]&0x0f)
+
+	// Header extension
+	if packet[0]&0x10 != 0 && len(packet) >= offset+4 {
+		offset += 4 + 4*(int(packet[offset+2])<<8|int(packet[offset+3]))
+	}
+
+	var end = len(packet)
+
+	// Padding, the last byte contains the number of padding bytes
+	if packet[0]&0x20 != 0 {
+		end -= int(packet[end-1])
+	}
+
+	if offset >= end {
+		return nil
+	}
+
+	var sequence = int(packet[2])<<8 | int(packet[3])
+
+	if b.sequence >= 0 {
+
+		if lost := (sequence - b.sequence - 1) & 0xffff; lost > 0 && lost < 0x8000 {
+			b.lost += lost
+			showDebug(fmt.Sprintf("Multicast:%d RTP packets lost (%s, total: %d)", lost, b.group.String(), b.lost), 2)
+		}
+
+	}
+
+	b.sequence = sequence
+
+	return packet[offset:end]
+}
+
+func (b *multicastBackend) Stop() {
+
+	b.stop.Do(func() {
+
+		// Closing the socket leaves the multicast group
+		if b.conn != nil {
+
+			if b.group.IP.IsMulticast() {
+				showInfo(fmt.Sprintf("Multicast:Leave %s", b.group.String()))
+			}
+
+			b.conn.Close()
+		}
+
+	})
+
+}
+
+func (b *multicastBackend) Error() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.err
+}
+
+// getMulticastInterface : Network interface for multicast streams (udp.interface), by name or IP address. Empty: Interface of the system.
+func getMulticastInterface(name string) (iface *net.Interface, err error) {
+
+	if len(name) == 0 {
+		return
+	}
+
+	if iface, err = net.InterfaceByName(name); err == nil {
+		return
+	}
+
+	var ip = net.ParseIP(name)
+	if ip == nil {
+		err = fmt.Errorf("Network interface for multicast streams not found: %s", name)
+		return
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+
+	for i := range interfaces {
+
+		addresses, err := interfaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, address := range addresses {
+
+			if network, ok := address.(*net.IPNet); ok && network.IP.Equal(ip) {
+				return &interfaces[i], nil
+			}
+
+		}
+
+	}
+
+	return nil, fmt.Errorf("Network interface for multicast streams not found: %s", name)
+}
@@ -0,0 +1,112 @@
+package src
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+// newTestRTP : RTP packet with the MPEG-TS payload. flags contains the padding, extension and CSRC count bits of the first byte.
+func newTestRTP(sequence int, flags byte, header []byte, payload []byte, padding int) []byte {
+
+	var packet = []byte{0x80 | flags, 33, byte(sequence >> 8), byte(sequence), 0, 0, 0, 0, 0, 0, 0, 1}
+	packet = append(packet, header...)
+	packet = append(packet, payload...)
+
+	if padding > 0 {
+		packet = append(packet, make([]byte, padding-1)...)
+		packet = append(packet, byte(padding))
+	}
+
+	return packet
+}
+
+func TestMulticastPayload(t *testing.T) {
+
+	var ts = bytes.Repeat(newTestPES(testVideoPID, false), 7)
+
+	var tests = []struct {
+		name    string
+		packets [][]byte
+		data    [][]byte
+		lost    int
+	}{
+		{
+			name:    "raw MPEG-TS",
+			packets: [][]byte{ts},
+			data:    [][]byte{ts},
+		},
+		{
+			name:    "RTP",
+			packets: [][]byte{newTestRTP(1, 0, nil, ts, 0)},
+			data:    [][]byte{ts},
+		},
+		{
+			name:    "RTP with CSRC",
+			packets: [][]byte{newTestRTP(1, 0x02, make([]byte, 8), ts, 0)},
+			data:    [][]byte{ts},
+		},
+		{
+			name:    "RTP with header extension",
+			packets: [][]byte{newTestRTP(1, 0x10, []byte{0xbe, 0xde, 0x00, 0x01, 1, 2, 3, 4}, ts, 0)},
+			data:    [][]byte{ts},
+		},
+		{
+			name:    "RTP with padding",
+			packets: [][]byte{newTestRTP(1, 0x20, nil, ts, 4)},
+			data:    [][]byte{ts},
+		},
+		{
+			name:    "RTP without payload",
+			packets: [][]byte{newTestRTP(1, 0, nil, nil, 0)},
+			data:    [][]byte{nil},
+		},
+		{
+			name:    "short datagram",
+			packets: [][]byte{{0x80, 33, 0, 1}},
+			data:    [][]byte{{0x80, 33, 0, 1}},
+		},
+		{
+			name:    "lost packets",
+			packets: [][]byte{newTestRTP(10, 0, nil, ts, 0), newTestRTP(13, 0, nil, ts, 0), newTestRTP(14, 0, nil, ts, 0)},
+			data:    [][]byte{ts, ts, ts},
+			lost:    2,
+		},
+		{
+			name:    "sequence number wraps around",
+			packets: [][]byte{newTestRTP(0xffff, 0, nil, ts, 0), newTestRTP(0, 0, nil, ts, 0)},
+			data:    [][]byte{ts, ts},
+			lost:    0,
+		},
+		{
+			name:    "reordered packet",
+			packets: [][]byte{newTestRTP(10, 0, nil, ts, 0), newTestRTP(9, 0, nil, ts, 0)},
+			data:    [][]byte{ts, ts},
+			lost:    0,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			var backend = newMulticastBackend("rtp://@239.0.0.1:5000")
+			backend.group = &net.UDPAddr{IP: net.IPv4(239, 0, 0, 1), Port: 5000}
+
+			for i, packet := range test.packets {
+
+				if data := backend.payload(packet); !bytes.Equal(data, test.data[i]) {
+					t.Errorf("packet %d: payload() = %d bytes, want %d bytes", i, len(data), len(test.data[i]))
+				}
+
+			}
+
+			if backend.lost != test.lost {
+				t.Errorf("lost packets = %d, want %d", backend.lost, test.lost)
+			}
+
+		})
+
+	}
+
+}
@@ -0,0 +1,218 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// upstreamStatus : Last known state of the upstream of a streaming URL, from the buffer or a probe
+type upstreamStatus struct {
+	Healthy bool
+	Error   string
+	Checked time.Time
+}
+
+// upstreamStatuses : Streaming URL -> upstreamStatus
+var upstreamStatuses sync.Map
+
+// streamProbes : Limits the number of upstream probes that run at the same time
+var streamProbes = make(chan struct{}, streamProbeLimit)
+
+// Upstream probes that run at the same time (stream.head.probe)
+const streamProbeLimit = 2
+
+// Timeout of an upstream probe, including the wait for a free probe
+const streamProbeTimeout = 5 * time.Second
+
+// The state of an upstream is used for this duration, afterwards it is unknown or probed again
+const upstreamStatusExpiry = 5 * time.Minute
+
+// setUpstreamStatus : Stores the result of the last connection to the upstream (nil: the upstream delivers data)
+func setUpstreamStatus(streamingURL string, err error) {
+
+	var status = upstreamStatus{Healthy: err == nil, Checked: time.Now()}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	upstreamStatuses.Store(streamingURL, status)
+
+}
+
+// getUpstreamStatus : Last known state of the upstream, false if it is unknown or expired
+func getUpstreamStatus(streamingURL string) (status upstreamStatus, ok bool) {
+
+	value, ok := upstreamStatuses.Load(streamingURL)
+	if !ok {
+		return
+	}
+
+	status = value.(upstreamStatus)
+	if time.Since(status.Checked) > upstreamStatusExpiry {
+		upstreamStatuses.Delete(streamingURL)
+		return upstreamStatus{}, false
+	}
+
+	return
+}
+
+// answerStreamHead : Answers a HEAD request with the information of Threadfin, without a connection to the provider.
+// Only if stream.head.probe is enabled, an upstream whose state is unknown is probed.
+func answerStreamHead(streamInfo StreamInfo, w http.ResponseWriter, r *http.Request) {
+
+	var transcode = getTranscode(r)
+	var priority = getTunerPriority(r)
+	var state = getRunningStreamState(streamInfo.PlaylistID, streamInfo.URL, transcode)
+
+	// A running stream does not need a tuner, otherwise a backup channel may have a free tuner.
+	// Transcoded streams use the tuner of the original stream.
+	var tuner = len(state) > 0 || tuners.Available(streamInfo.PlaylistID, streamInfo.PlaylistID+getStreamMD5(streamInfo.URL, ""), priority)
+
+	for _, backup := range streamInfo.BackupChannels {
+
+		if tuner {
+			break
+		}
+
+		tuner = tuners.Available(backup.PlaylistID, backup.PlaylistID+getStreamMD5(backup.URL, ""), priority)
+
+	}
+
+	if len(state) == 0 {
+
+		status, ok := getUpstreamStatus(streamInfo.URL)
+
+		if !ok && Settings.StreamHeadProbe {
+			probeUpstream(r.Context(), streamInfo.PlaylistID, streamInfo.URL)
+			status, ok = getUpstreamStatus(streamInfo.URL)
+		}
+
+		switch {
+
+		case !ok:
+			state = "unknown"
+
+		case status.Healthy:
+			state = "healthy"
+
+		default:
+			state = "failed"
+
+		}
+
+	}
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "close")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-Threadfin-Tuner", strconv.FormatBool(tuner))
+	w.Header().Set("X-Threadfin-Upstream", state)
+
+	// With slates, the client receives a video in any case
+	if (!tuner || state == "failed") && !Settings.BufferSlates {
+		w.Header().Set("Retry-After", strconv.Itoa(int(slateRetryInterval.Seconds())))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+}
+
+// getRunningStreamState : State of the stream if the channel is already streaming (streaming, starting), empty otherwise
+func getRunningStreamState(playlistID, streamingURL, transcode string) (state string) {
+
+	Lock.RLock()
+	defer Lock.RUnlock()
+
+	p, ok := BufferInformation.Load(playlistID)
+	if !ok {
+		return
+	}
+
+	for _, stream := range p.(*Playlist).Streams {
+
+		if stream.URL != streamingURL || stream.Transcode != transcode || stream.buffer == nil || stream.buffer.Closed() {
+			continue
+		}
+
+		if stream.Status {
+			return "streaming"
+		}
+
+		return "starting"
+	}
+
+	return
+}
+
+// probeUpstream : Checks with a HEAD request whether the provider delivers the stream. Only HTTP sources are probed,
+// the number of probes at the same time is limited. If no probe is free within the timeout, the state remains unknown.
+func probeUpstream(ctx context.Context, playlistID, streamingURL string) {
+
+	if !strings.HasPrefix(streamingURL, "http://") && !strings.HasPrefix(streamingURL, "https://") {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, streamProbeTimeout)
+	defer cancel()
+
+	select {
+
+	case streamProbes <- struct{}{}:
+		defer func() { <-streamProbes }()
+
+	case <-ctx.Done():
+		showDebug("Streaming Status:No free upstream probe, the state of the upstream is unknown", 2)
+		return
+
+	}
+
+	var backend = newNativeBackend(*newBufferPlaylist(playlistID), getBufferProfile(""), streamingURL)
+
+	var probe = func(method string) (resp *http.Response, err error) {
+
+		req, err := http.NewRequestWithContext(ctx, method, streamingURL, nil)
+		if err != nil {
+			return
+		}
+
+		req.Header = backend.headers.Clone()
+
+		return backend.client.Do(req)
+	}
+
+	resp, err := probe("HEAD")
+
+	// Servers that do not support HEAD are probed with GET, the connection is closed after the headers
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = probe("GET")
+	}
+
+	if err != nil {
+
+		if ctx.Err() == nil {
+			setUpstreamStatus(streamingURL, err)
+		}
+
+		return
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("%d: %s (%s)", resp.StatusCode, http.StatusText(resp.StatusCode), getErrMsg(4004))
+	}
+
+	showDebug(fmt.Sprintf("Streaming Status:Upstream probe %s (%d)", streamingURL, resp.StatusCode), 2)
+
+	setUpstreamStatus(streamingURL, err)
+
+}
@@ -0,0 +1,151 @@
+package src
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// BufferProfile : Named settings for the buffer process
+type BufferProfile struct {
+	Path           string            `json:"path"`
+	Args           string            `json:"args"`
+	Env            map[string]string `json:"env"`
+	StartupTimeout int               `json:"startup.timeout"`
+	StallTimeout   int               `json:"stall.timeout"`
+}
+
+// defaultBufferPath : Python yt-dlp wrapper script for ffmpeg
+const defaultBufferPath = "/home/threadfin/bin/wrapper"
+
+// defaultStartupTimeout : Seconds until the buffer has to deliver the first segment
+const defaultStartupTimeout = 20
+
+// defaultStallTimeout : Seconds without new data after which the upstream of a running stream is restarted
+const defaultStallTimeout = 10
+
+// Placeholders that can be used in the arguments of a buffer profile
+var bufferProfilePlaceholders = []string{"[URL]", "[USER-AGENT]", "[PROXY]", "[REFERER]", "[ORIGIN]", "[HEADERS]"}
+
+// getBufferProfileName : Profile for a channel. The most specific assignment wins (channel, group, provider).
+func getBufferProfileName(playlistID, groupTitle, channelProfile string) (name string) {
+
+	if _, ok := Settings.BufferProfiles[channelProfile]; ok {
+		return channelProfile
+	}
+
+	if groupProfile, ok := Settings.BufferProfileGroups[groupTitle]; ok {
+		if _, ok := Settings.BufferProfiles[groupProfile]; ok {
+			return groupProfile
+		}
+	}
+
+	var providerProfile = getProviderParameter(playlistID, getPlaylistType(playlistID), "buffer.profile")
+	if _, ok := Settings.BufferProfiles[providerProfile]; ok {
+		return providerProfile
+	}
+
+	return
+}
+
+// getBufferProfile : Settings of a named profile, without a name the global FFmpeg settings are used
+func getBufferProfile(name string) (profile BufferProfile) {
+
+	if p, ok := Settings.BufferProfiles[name]; ok && len(name) > 0 {
+		profile = p
+	} else {
+		profile.Args = Settings.FFmpegOptions
+	}
+
+	if len(profile.Path) == 0 {
+		profile.Path = defaultBufferPath
+	}
+
+	if len(strings.TrimSpace(profile.Args)) == 0 {
+		profile.Args = System.FFmpeg.DefaultOptions
+	}
+
+	if profile.StartupTimeout <= 0 {
+		profile.StartupTimeout = defaultStartupTimeout
+	}
+
+	if profile.StallTimeout <= 0 {
+		profile.StallTimeout = defaultStallTimeout
+	}
+
+	return
+}
+
+// buildBufferArgs : Replaces the placeholders of the profile arguments
+func (profile BufferProfile) buildBufferArgs(playlist Playlist, streamingURL string) (args []string) {
+
+	var userAgent = playlist.HTTP.UserAgent
+	var proxy = playlist.HTTP.Proxy
+	var headers = playlist.HTTP.FFmpegHeaders(streamingURL)
+
+	var replacer = strings.NewReplacer(
+		"[URL]", streamingURL,
+		"[USER-AGENT]", userAgent,
+		"[PROXY]", proxy,
+		"[REFERER]", playlist.HTTP.Headers.Get("Referer"),
+		"[ORIGIN]", playlist.HTTP.Headers.Get("Origin"),
+		"[HEADERS]", headers,
+	)
+
+	// Profiles without their own placeholders for the HTTP options get them in front of the arguments (as before)
+	var custom bool
+	for _, placeholder := range bufferProfilePlaceholders[1:] {
+		if strings.Contains(profile.Args, placeholder) {
+			custom = true
+		}
+	}
+
+	if !custom {
+
+		if len(userAgent) != 0 {
+			args = append(args, "-user_agent", userAgent)
+		}
+
+		if len(proxy) != 0 {
+			args = append(args, "-http_proxy", proxy)
+		}
+
+		if len(headers) != 0 {
+			args = append(args, "-headers", headers)
+		}
+
+	}
+
+	for _, a := range strings.Fields(profile.Args) {
+
+		var arg = replacer.Replace(a)
+
+		// Options whose placeholder is empty are removed together with the option itself
+		if len(arg) == 0 && a != arg {
+
+			if len(args) > 0 && strings.HasPrefix(args[len(args)-1], "-") {
+				args = args[:len(args)-1]
+			}
+
+			continue
+		}
+
+		args = append(args, arg)
+
+	}
+
+	return
+}
+
+// buildBufferEnv : Environment for the buffer process
+func (profile BufferProfile) buildBufferEnv() (env []string) {
+
+	// Set this explicitly to avoid issues with VLC
+	env = append(os.Environ(), "DISPLAY=:0")
+
+	for key, value := range profile.Env {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	return
+}
@@ -31,7 +31,7 @@ func getProviderData(fileType, fileID string) (err error) {
 		}
 
                 // Default keys for the provider data
-		var keys = []string{"name", "description", "type", "file." + System.AppName, "file.source", "tuner", "http_proxy.ip", "http_proxy.port", "last.update", "compatibility", "counter.error", "counter.download", "provider.availability"}
+		var keys = []string{"name", "description", "type", "file." + System.AppName, "file.source", "tuner", "buffer", "http_proxy.ip", "http_proxy.port", "last.update", "compatibility", "counter.error", "counter.download", "provider.availability"}
 
 		for _, key := range keys {
 
@@ -70,6 +70,11 @@ func getProviderData(fileType, fileID string) (err error) {
 						}
 					}
 
+				case "buffer":
+					if fileType == "m3u" || fileType == "hdhr" {
+						data[key] = getBufferType(id, fileType)
+					}
+
 				case "compatibility":
 					data[key] = make(map[string]interface{})
 
@@ -175,18 +180,7 @@ func getProviderData(fileType, fileID string) (err error) {
 
 		var data = d.(map[string]interface{})
 		var fileSource = data["file.source"].(string)
-		var httpProxyIp = ""
-		if data["http_proxy.ip"] != nil {
-			httpProxyIp = data["http_proxy.ip"].(string)
-		}
-		var httpProxyPort = ""
-		if data["http_proxy.port"] != nil {
-			httpProxyPort = data["http_proxy.port"].(string)
-		}
-		var httpProxyUrl = ""
-		if httpProxyIp != "" && httpProxyPort != "" {
-			httpProxyUrl = fmt.Sprintf("http://%s:%s", httpProxyIp, httpProxyPort)
-		}
+		var provider = getProviderHTTP(dataID, fileType)
 
 		newProvider = false
 
@@ -209,7 +203,7 @@ func getProviderData(fileType, fileID string) (err error) {
                         // Loading from HDHomeRun tuner
 			showInfo("Tuner:" + fileSource)
 			var tunerURL = "http://" + fileSource + "/lineup.json"
-			serverFileName, body, err = downloadFileFromServer(tunerURL, httpProxyUrl)
+			serverFileName, body, err = downloadFileFromServer(tunerURL, provider)
 
 		default:
 
@@ -217,7 +211,7 @@ func getProviderData(fileType, fileID string) (err error) {
 
 				// Loading from Remote Server
 				showInfo("Download:" + fileSource)
-				serverFileName, body, err = downloadFileFromServer(fileSource, httpProxyUrl)
+				serverFileName, body, err = downloadFileFromServer(fileSource, provider)
 
 			} else {
 
@@ -319,42 +313,26 @@ func getProviderData(fileType, fileID string) (err error) {
 	return
 }
 
-func downloadFileFromServer(providerURL string, proxyUrl string) (filename string, body []byte, err error) {
+// downloadFileFromServer : Downloads a playlist or XMLTV file with the HTTP options of the provider
+func downloadFileFromServer(providerURL string, provider providerHTTP) (filename string, body []byte, err error) {
 	_, err = url.ParseRequestURI(providerURL)
 	if err != nil {
 		return
 	}
 
-	httpClient := &http.Client{}
-
-	if proxyUrl != "" {
-		proxyURL, err := url.Parse(proxyUrl)
-		if err != nil {
-			return "", nil, err
-		}
-
-		httpClient = &http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyURL(proxyURL),
-			},
-		}
-	}
-
 	req, err := http.NewRequest("GET", providerURL, nil)
 	if err != nil {
 		return
 	}
 
-	req.Header.Set("User-Agent", Settings.UserAgent)
+	req.Header = provider.Header()
 
-	resp, err := httpClient.Do(req)
+	resp, err := provider.Client().Do(req)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 
-	resp.Header.Set("User-Agent", Settings.UserAgent)
-
 	if resp.StatusCode != http.StatusOK {
 		err = fmt.Errorf("%d: %s %s", resp.StatusCode, providerURL, http.StatusText(resp.StatusCode))
 		return
@@ -0,0 +1,731 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordingRule : Programmes of the EPG (threadfin.xml) that are recorded (recording.rules)
+type RecordingRule struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`            // once: the next matching programme, series: every matching programme
+	Title      string `json:"title"`           // Title of the programme, not case sensitive
+	Channel    string `json:"channel"`         // Channel ID of the EPG, empty for all channels
+	EpisodeNum string `json:"episodeNum"`      // episode-num of the programme, empty for all episodes
+	Start      string `json:"start,omitempty"` // Start time of the programme (XMLTV format), empty for every start time
+}
+
+// Recording : Scheduled, running or finished recording
+type Recording struct {
+	ID         string    `json:"id"`
+	RuleID     string    `json:"ruleID"`
+	Title      string    `json:"title"`
+	SubTitle   string    `json:"subTitle,omitempty"`
+	EpisodeNum string    `json:"episodeNum,omitempty"`
+	ChannelID  string    `json:"channelID"`
+	Channel    string    `json:"channel"`
+	Start      time.Time `json:"start"`
+	Stop       time.Time `json:"stop"`
+	File       string    `json:"file"` // File name in the recordings folder
+	Size       int64     `json:"size"`
+	Status     string    `json:"status"` // scheduled, recording, completed, failed
+	Error      string    `json:"error,omitempty"`
+	URL        string    `json:"url,omitempty"`
+}
+
+// dvrRecorder : Recordings and the EPG they are scheduled from
+type dvrRecorder struct {
+	recordings map[string]*Recording
+	running    map[string]context.CancelFunc
+	loaded     bool
+	changed    bool // The recordings differ from the saved file
+
+	epg        XMLTV
+	epgModTime time.Time
+
+	mutex sync.Mutex
+}
+
+// recorder : Recordings of all rules
+var recorder = &dvrRecorder{recordings: make(map[string]*Recording), running: make(map[string]context.CancelFunc)}
+
+// Time between two checks of the recording rules
+const recordingInterval = 30 * time.Second
+
+// Time format of the XMLTV file
+const xmltvTimeFormat = "20060102150405 -0700"
+
+// Characters that are not used in file names
+var recordingFileName = regexp.MustCompile(`[\\/:*?"<>|]+`)
+
+// scheduleRecordings : Checks the recording rules against the EPG and starts the recordings
+func scheduleRecordings() {
+
+	for {
+
+		if err := checkRecordings(); err != nil {
+			ShowError(err, 0)
+		}
+
+		time.Sleep(recordingInterval)
+
+	}
+
+}
+
+// getRecordingsFolder : Folder of the recordings (recordings.path)
+func getRecordingsFolder() (folder string) {
+
+	folder = System.Folder.Recordings
+	if len(Settings.RecordingsPath) > 0 {
+		folder = Settings.RecordingsPath
+	}
+
+	return getPlatformPath(strings.TrimRight(folder, string(os.PathSeparator)) + string(os.PathSeparator))
+}
+
+// checkRecordings : Schedules the programmes that match the rules and starts the recordings that are due
+func checkRecordings() (err error) {
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if !recorder.loaded {
+		recorder.load()
+	}
+
+	if len(Settings.RecordingRules) > 0 {
+
+		err = recorder.loadEPG()
+		if err != nil {
+			return
+		}
+
+		recorder.schedule()
+
+	}
+
+	var now = time.Now()
+	var paddingStart = time.Duration(Settings.RecordingPaddingStart) * time.Minute
+
+	for _, recording := range recorder.recordings {
+
+		if recording.Status != "scheduled" || now.Before(recording.Start.Add(-paddingStart)) {
+			continue
+		}
+
+		var end = recording.Stop.Add(time.Duration(Settings.RecordingPaddingEnd) * time.Minute)
+		ctx, cancel := context.WithDeadline(context.Background(), end)
+
+		recording.Status = "recording"
+		recorder.running[recording.ID] = cancel
+
+		recorder.changed = true
+
+		go recordProgramme(ctx, recording)
+
+	}
+
+	if !recorder.changed {
+		return
+	}
+
+	return recorder.save()
+}
+
+// schedule : Creates the recordings of all upcoming programmes that match a rule.
+// Rules of the type once record the next matching programme and are removed afterwards.
+func (d *dvrRecorder) schedule() {
+
+	var now = time.Now()
+	var paddingEnd = time.Duration(Settings.RecordingPaddingEnd) * time.Minute
+	var next = make(map[string]*Program)
+	var done = make(map[string]bool)
+
+	settingsMutex.Lock()
+	var rules = Settings.RecordingRules
+	settingsMutex.Unlock()
+
+	for _, program := range d.epg.Program {
+
+		var stop = parseXMLTVTime(program.Stop)
+		if stop.IsZero() || now.After(stop.Add(paddingEnd)) {
+			continue
+		}
+
+		for _, rule := range rules {
+
+			if !rule.match(program) {
+				continue
+			}
+
+			if rule.Type == "series" {
+				d.add(rule, program)
+				continue
+			}
+
+			if n, ok := next[rule.ID]; !ok || parseXMLTVTime(program.Start).Before(parseXMLTVTime(n.Start)) {
+				next[rule.ID] = program
+			}
+
+		}
+
+	}
+
+	for _, rule := range rules {
+
+		if program, ok := next[rule.ID]; ok {
+			d.add(rule, program)
+			done[rule.ID] = true
+		}
+
+	}
+
+	if len(done) == 0 {
+		return
+	}
+
+	// The rules are removed from the current settings, changes of the web interface in the meantime are kept
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	var settings = Settings
+	settings.RecordingRules = make([]RecordingRule, 0)
+
+	for _, rule := range Settings.RecordingRules {
+
+		if !done[rule.ID] {
+			settings.RecordingRules = append(settings.RecordingRules, rule)
+		}
+
+	}
+
+	if err := saveSettings(settings); err != nil {
+		ShowError(err, 0)
+	}
+
+}
+
+// add : Schedules the recording of a programme, unless it is already scheduled
+func (d *dvrRecorder) add(rule RecordingRule, program *Program) {
+
+	var id = getMD5(program.Channel + program.Start)
+	if _, ok := d.recordings[id]; ok {
+		return
+	}
+
+	var recording = &Recording{
+		ID:         id,
+		RuleID:     rule.ID,
+		Title:      getProgramTitle(program),
+		EpisodeNum: getProgramEpisodeNum(program),
+		ChannelID:  program.Channel,
+		Start:      parseXMLTVTime(program.Start),
+		Stop:       parseXMLTVTime(program.Stop),
+		Status:     "scheduled",
+	}
+
+	if len(program.SubTitle) > 0 {
+		recording.SubTitle = program.SubTitle[0].Value
+	}
+
+	// Series: Episodes that have already been recorded are skipped
+	if rule.Type == "series" && d.recorded(recording) {
+		return
+	}
+
+	recording.Channel = d.channelName(program.Channel)
+	recording.File = getRecordingFileName(recording)
+
+	d.recordings[id] = recording
+	d.changed = true
+
+	showInfo(fmt.Sprintf("DVR:Scheduled: %s (%s) - %s", recording.Title, recording.Channel, recording.Start.Local().Format("2006-01-02 15:04")))
+
+}
+
+// parseXMLTVTime : Time of the XMLTV file, without a time zone the local time is used. Zero time if the format is invalid.
+func parseXMLTVTime(value string) (t time.Time) {
+
+	t, err := time.Parse(xmltvTimeFormat, strings.TrimSpace(value))
+	if err != nil {
+		t, _ = time.ParseInLocation(xmltvTimeFormat[:14], strings.TrimSpace(value), time.Local)
+	}
+
+	return
+}
+
+// match : Checks whether the programme matches the rule
+func (rule RecordingRule) match(program *Program) bool {
+
+	if len(rule.Title) == 0 && len(rule.EpisodeNum) == 0 && len(rule.Start) == 0 {
+		return false
+	}
+
+	if len(rule.Channel) > 0 && rule.Channel != program.Channel {
+		return false
+	}
+
+	if len(rule.Start) > 0 && rule.Start != program.Start {
+		return false
+	}
+
+	if len(rule.Title) > 0 && !strings.EqualFold(rule.Title, getProgramTitle(program)) {
+		return false
+	}
+
+	if len(rule.EpisodeNum) > 0 {
+
+		var found bool
+		for _, episode := range program.EpisodeNum {
+
+			if strings.TrimSpace(episode.Value) == rule.EpisodeNum {
+				found = true
+			}
+
+		}
+
+		if !found {
+			return false
+		}
+
+	}
+
+	return true
+}
+
+// recorded : The episode has already been recorded (or is scheduled)
+func (d *dvrRecorder) recorded(recording *Recording) bool {
+
+	if len(recording.EpisodeNum) == 0 {
+		return false
+	}
+
+	for _, r := range d.recordings {
+
+		if r.Status != "failed" && r.EpisodeNum == recording.EpisodeNum && strings.EqualFold(r.Title, recording.Title) {
+			return true
+		}
+
+	}
+
+	return false
+}
+
+// channelName : Name of the channel in the EPG
+func (d *dvrRecorder) channelName(channelID string) string {
+
+	for _, channel := range d.epg.Channel {
+
+		if channel.ID == channelID && len(channel.DisplayName) > 0 {
+			return channel.DisplayName[0].Value
+		}
+
+	}
+
+	return channelID
+}
+
+// loadEPG : Reads the EPG created by Threadfin (threadfin.xml), only if it has changed
+func (d *dvrRecorder) loadEPG() (err error) {
+
+	info, err := os.Stat(System.File.XML)
+	if err != nil {
+		return
+	}
+
+	if info.ModTime().Equal(d.epgModTime) {
+		return
+	}
+
+	content, err := readByteFromFile(System.File.XML)
+	if err != nil {
+		return
+	}
+
+	var epg XMLTV
+	err = xml.Unmarshal(content, &epg)
+	if err != nil {
+		return
+	}
+
+	d.epg = epg
+	d.epgModTime = info.ModTime()
+
+	return
+}
+
+// load : Reads the recordings of the recordings folder. Recordings that were interrupted by a restart are continued, if the programme is not over yet.
+func (d *dvrRecorder) load() {
+
+	d.loaded = true
+
+	content, err := readByteFromFile(getRecordingsFolder() + "recordings.json")
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(content, &d.recordings)
+	if err != nil {
+		ShowError(err, 0)
+		d.recordings = make(map[string]*Recording)
+		return
+	}
+
+	var paddingEnd = time.Duration(Settings.RecordingPaddingEnd) * time.Minute
+
+	for _, recording := range d.recordings {
+
+		if recording.Status != "recording" {
+			continue
+		}
+
+		recording.Status = "scheduled"
+		d.changed = true
+
+		if time.Now().After(recording.Stop.Add(paddingEnd)) {
+			recording.Status = "failed"
+			recording.Error = "Interrupted"
+		}
+
+	}
+
+}
+
+// save : Saves the recordings in the recordings folder, must be called with the lock held
+func (d *dvrRecorder) save() (err error) {
+
+	var folder = getRecordingsFolder()
+
+	err = checkFolder(folder)
+	if err != nil {
+		return
+	}
+
+	if err = saveMapToJSONFile(folder+"recordings.json", d.recordings); err == nil {
+		d.changed = false
+	}
+
+	return
+}
+
+// update : Changes a recording and saves the recordings
+func (d *dvrRecorder) update(id string, update func(recording *Recording)) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if recording, ok := d.recordings[id]; ok {
+		update(recording)
+	}
+
+	if cancel, ok := d.running[id]; ok {
+		cancel()
+		delete(d.running, id)
+	}
+
+	if err := d.save(); err != nil {
+		ShowError(err, 0)
+	}
+
+}
+
+// recordProgramme : Records the programme into the recordings folder until the context ends (end of the programme, deleted).
+// The stream uses a tuner like every other client. If no tuner is available or the stream ends too early, Threadfin tries again.
+func recordProgramme(ctx context.Context, recording *Recording) {
+
+	var id, title, channelID, fileName = recording.ID, recording.Title, recording.ChannelID, recording.File
+	var status, message = "failed", ""
+
+	defer func() {
+
+		recorder.update(id, func(r *Recording) {
+
+			r.Status = status
+			r.Error = message
+
+			if info, err := os.Stat(getRecordingsFolder() + r.File); err == nil {
+				r.Size = info.Size()
+			}
+
+		})
+
+		showInfo(fmt.Sprintf("DVR:Recording %s: %s", status, title))
+
+	}()
+
+	streamInfo, err := getRecordingStream(channelID)
+	if err != nil {
+		message = err.Error()
+		return
+	}
+
+	path, err := getRecordingPath(fileName)
+	if err != nil {
+		message = err.Error()
+		return
+	}
+
+	err = checkFolder(filepath.Dir(path) + string(os.PathSeparator))
+	if err != nil {
+		message = err.Error()
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		message = err.Error()
+		return
+	}
+	defer file.Close()
+
+	showInfo(fmt.Sprintf("DVR:Recording started: %s (%s)", title, streamInfo.Name))
+
+	for ctx.Err() == nil {
+
+		r, _ := http.NewRequestWithContext(ctx, "GET", "/recordings/"+id+".ts", nil)
+		r.RemoteAddr = "127.0.0.1"
+		r.Header.Set("User-Agent", System.Name+" DVR")
+
+		playlistID, streamID, ok := connectStream(streamInfo.PlaylistID, streamInfo.URL, streamInfo.BackupChannels, streamInfo.Name, streamInfo.BufferProfile, 0, r)
+		if ok {
+			message = ""
+			sendStream("recording", playlistID, streamID, streamInfo.Name, file, r)
+		} else {
+			message = "No tuner available"
+			showInfo(fmt.Sprintf("DVR:No tuner available for %s, next attempt in %d seconds", title, int(recordingInterval.Seconds())))
+		}
+
+		// The stream has ended before the end of the programme (no tuner, stream error), the recording is continued
+		select {
+
+		case <-ctx.Done():
+
+		case <-time.After(recordingInterval):
+
+		}
+
+	}
+
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		status = "completed"
+	} else if len(message) == 0 {
+		message = "No data"
+	}
+
+}
+
+// getRecordingStream : Stream of an active channel with the channel ID of the EPG
+func getRecordingStream(channelID string) (streamInfo StreamInfo, err error) {
+
+	for _, dxc := range Data.XEPG.Channels {
+
+		var xepgChannel XEPGChannelStruct
+		err = json.Unmarshal([]byte(mapToJSON(dxc)), &xepgChannel)
+		if err != nil {
+			return
+		}
+
+		if xepgChannel.XActive && xepgChannel.XChannelID == channelID {
+
+			streamInfo.PlaylistID = xepgChannel.FileM3UID
+			streamInfo.URL = xepgChannel.URL
+			streamInfo.BackupChannels = xepgChannel.BackupChannels
+			streamInfo.Name = xepgChannel.XName
+			streamInfo.BufferProfile = getBufferProfileName(xepgChannel.FileM3UID, xepgChannel.XGroupTitle, xepgChannel.XBufferProfile)
+
+			return
+		}
+
+	}
+
+	err = fmt.Errorf("Channel %s not found", channelID)
+
+	return
+}
+
+// getRecordingFileName : <Title>/<Title> - <Episode or date>.ts. Without a usable title, the name of the channel is used.
+func getRecordingFileName(recording *Recording) string {
+
+	var title = getRecordingName(recording.Title)
+	if len(title) == 0 {
+		title = getRecordingName(recording.Channel)
+	}
+
+	if len(title) == 0 {
+		title = "Recording"
+	}
+
+	var name = getRecordingName(recording.EpisodeNum)
+	if len(name) == 0 {
+		name = recording.Start.Local().Format("2006-01-02 1504")
+	}
+
+	return title + string(os.PathSeparator) + title + " - " + name + ".ts"
+}
+
+// getRecordingName : Part of a file name, without path separators and without leading or trailing dots (., ..)
+func getRecordingName(value string) string {
+	return strings.Trim(recordingFileName.ReplaceAllString(value, "_"), " .")
+}
+
+// getRecordingPath : Path of a recording file, which has to be inside the recordings folder
+func getRecordingPath(fileName string) (path string, err error) {
+
+	var folder = filepath.Clean(getRecordingsFolder())
+
+	path = filepath.Clean(filepath.Join(folder, fileName))
+	if !strings.HasPrefix(path, folder+string(os.PathSeparator)) {
+		err = fmt.Errorf("Recording file is outside of the recordings folder: %s", fileName)
+	}
+
+	return
+}
+
+// getProgramTitle : First title of the programme
+func getProgramTitle(program *Program) string {
+
+	if len(program.Title) > 0 {
+		return program.Title[0].Value
+	}
+
+	return ""
+}
+
+// getProgramEpisodeNum : First episode number of the programme
+func getProgramEpisodeNum(program *Program) string {
+
+	for _, episode := range program.EpisodeNum {
+
+		if len(strings.TrimSpace(episode.Value)) > 0 {
+			return strings.TrimSpace(episode.Value)
+		}
+
+	}
+
+	return ""
+}
+
+// getRecordings : All recordings, sorted by start time
+func getRecordings() (recordings []Recording) {
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recordings = make([]Recording, 0)
+
+	for _, recording := range recorder.recordings {
+
+		var r = *recording
+		r.URL = fmt.Sprintf("%s://%s/recordings/%s.ts", System.ServerProtocol.DVR, System.Domain, r.ID)
+
+		if info, err := os.Stat(getRecordingsFolder() + r.File); err == nil {
+			r.Size = info.Size()
+		}
+
+		recordings = append(recordings, r)
+
+	}
+
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].Start.Before(recordings[j].Start)
+	})
+
+	return
+}
+
+// deleteRecording : Removes the recording and its file, a running recording is stopped first
+func deleteRecording(id string) (err error) {
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recording, ok := recorder.recordings[id]
+	if !ok {
+		return errors.New(getErrMsg(5002))
+	}
+
+	if cancel, ok := recorder.running[id]; ok {
+		cancel()
+	}
+
+	delete(recorder.recordings, id)
+
+	// Files outside of the recordings folder are not removed
+	if path, err := getRecordingPath(recording.File); err == nil {
+
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+	}
+
+	showInfo(fmt.Sprintf("DVR:Recording deleted: %s", recording.Title))
+
+	return recorder.save()
+}
+
+// Recordings : Web Server /recordings/ (list) and /recordings/<id>.ts (with Range support)
+func Recordings(w http.ResponseWriter, r *http.Request) {
+
+	if err := urlAuth(r, "m3u"); err != nil {
+		ShowError(err, 000)
+		httpStatusError(w, r, 403)
+		return
+	}
+
+	var id = strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/recordings/"), ".ts")
+
+	if len(id) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(mapToJSON(getRecordings())))
+		return
+	}
+
+	recorder.mutex.Lock()
+	recording, ok := recorder.recordings[id]
+	var fileName string
+	if ok {
+		fileName = recording.File
+	}
+	recorder.mutex.Unlock()
+
+	if !ok {
+		httpStatusError(w, r, 404)
+		return
+	}
+
+	path, err := getRecordingPath(fileName)
+	if err != nil {
+		httpStatusError(w, r, 404)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		httpStatusError(w, r, 404)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		httpStatusError(w, r, 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	http.ServeContent(w, r, filepath.Base(fileName), info.ModTime(), file)
+
+}
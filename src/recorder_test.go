@@ -0,0 +1,98 @@
+package src
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetRecordingPath(t *testing.T) {
+
+	var settings = Settings
+	defer func() { Settings = settings }()
+
+	var folder = t.TempDir()
+	Settings.RecordingsPath = folder
+
+	var tests = []struct {
+		fileName string
+		path     string
+		err      bool
+	}{
+		{fileName: "News/News - 2026-10-16 2000.ts", path: filepath.Join(folder, "News", "News - 2026-10-16 2000.ts")},
+		{fileName: "News/../Movie.ts", path: filepath.Join(folder, "Movie.ts")},
+		{fileName: "/News.ts", path: filepath.Join(folder, "News.ts")},
+		{fileName: "../News.ts", err: true},
+		{fileName: "News/../../News.ts", err: true},
+		{fileName: "../" + filepath.Base(folder) + "-other/News.ts", err: true},
+		{fileName: "..", err: true},
+		{fileName: "", err: true},
+		{fileName: ".", err: true},
+	}
+
+	for _, test := range tests {
+
+		path, err := getRecordingPath(test.fileName)
+
+		if test.err {
+
+			if err == nil {
+				t.Errorf("getRecordingPath(%q) = %s, want an error", test.fileName, path)
+			}
+
+			continue
+		}
+
+		if err != nil || path != test.path {
+			t.Errorf("getRecordingPath(%q) = %s, %v, want %s", test.fileName, path, err, test.path)
+		}
+
+	}
+
+}
+
+func TestGetRecordingFileName(t *testing.T) {
+
+	var start = time.Date(2026, 10, 16, 20, 15, 0, 0, time.Local)
+
+	var tests = []struct {
+		name      string
+		recording Recording
+		fileName  string
+	}{
+		{
+			name:      "title and episode",
+			recording: Recording{Title: "News", EpisodeNum: "S01E02", Start: start},
+			fileName:  filepath.Join("News", "News - S01E02.ts"),
+		},
+		{
+			name:      "title without episode",
+			recording: Recording{Title: "News", Start: start},
+			fileName:  filepath.Join("News", "News - 2026-10-16 2015.ts"),
+		},
+		{
+			name:      "path separators in the title",
+			recording: Recording{Title: "../../etc/passwd", EpisodeNum: "a/b", Start: start},
+			fileName:  filepath.Join("_.._etc_passwd", "_.._etc_passwd - a_b.ts"),
+		},
+		{
+			name:      "title of dots",
+			recording: Recording{Title: "..", Channel: "Channel 1", Start: start},
+			fileName:  filepath.Join("Channel 1", "Channel 1 - 2026-10-16 2015.ts"),
+		},
+		{
+			name:      "without title and channel",
+			recording: Recording{Start: start},
+			fileName:  filepath.Join("Recording", "Recording - 2026-10-16 2015.ts"),
+		},
+	}
+
+	for _, test := range tests {
+
+		if fileName := getRecordingFileName(&test.recording); fileName != test.fileName {
+			t.Errorf("%s: getRecordingFileName() = %s, want %s", test.name, fileName, test.fileName)
+		}
+
+	}
+
+}
@@ -0,0 +1,955 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/avfs/avfs"
+)
+
+// streamBuffer : Ring buffer of an upstream stream. All clients of the stream read from it with their own cursor.
+type streamBuffer struct {
+	Key string
+
+	segments    []*bufferSegment
+	sequence    int64
+	segmentSize int
+	maxSegments int
+	size        int64
+
+	// Time shift window, segments are kept for this duration instead of a fixed number of segments
+	window time.Duration
+
+	// The next segment starts with data from another source
+	discontinuity   bool
+	discontinuities int64
+
+	// MPEG-TS: Latest PAT / PMT of the stream, segments are cut at keyframes as soon as the stream signals them
+	tables    []byte
+	keyframes bool
+	keyframe  bool // The next segment starts with a keyframe
+
+	// Filesystem for the completed segments, nil if the buffer is stored in RAM
+	vfs    avfs.VFS
+	folder string
+
+	closed bool
+	err    error
+	done   chan struct{} // Closed together with the buffer
+
+	// Ingress bandwidth of the upstream and data received since the start of the buffer
+	bandwidth BandwidthCalculation
+	received  int64
+
+	mutex sync.Mutex
+	cond  *sync.Cond
+}
+
+// bufferSegment : Part of the stream in the ring buffer
+type bufferSegment struct {
+	Sequence int64
+	Data     []byte
+	Size     int
+	Created  time.Time
+	Duration time.Duration
+	Sealed   bool
+	Stored   bool
+
+	// First segment after a change of the source
+	Discontinuity bool
+
+	// Number of changes of the source up to this segment (HLS discontinuity sequence)
+	DiscontinuitySequence int64
+
+	// The segment starts with a keyframe, clients can start to decode the video with this segment
+	Keyframe bool
+
+	// PAT / PMT that were valid when the segment was created, they are sent before the first segment of a client
+	Tables []byte
+}
+
+// bufferReader : Cursor of a client in the ring buffer
+type bufferReader struct {
+	buffer   *streamBuffer
+	sequence int64
+	offset   int
+
+	// Data that is sent before the next segment (PAT / PMT)
+	prefix []byte
+
+	// Segment file that is currently read (disk buffer)
+	file     avfs.File
+	fileSeq  int64
+	fileData []byte
+
+	ctx  context.Context
+	stop func() bool
+}
+
+// Number of segments that are kept in the ring buffer
+const bufferSegments = 20
+
+// Size of the chunks that are read from the segment files
+const bufferReadSize = 64 * 1024
+
+// Segments of streams with keyframes are cut at the first keyframe after the segment size, at the latest at this multiple of the segment size
+const bufferKeyframeSegmentLimit = 4
+
+// errBufferClosed : The ring buffer was closed without an error from the buffer
+var errBufferClosed = errors.New("Buffer closed")
+
+// bufferBytes : Size of all ring buffers
+var bufferBytes atomic.Int64
+
+// getStreamBuffer : Ring buffer of the stream, a new one is created if the stream is not yet buffered
+func getStreamBuffer(key string) (buffer *streamBuffer) {
+
+	if b, ok := streamBuffers.Load(key); ok {
+		return b.(*streamBuffer)
+	}
+
+	var segmentSize = Settings.BufferSize * 1024 / 2
+	if segmentSize <= 0 {
+		segmentSize = 512 * 1024
+	}
+
+	// Segments contain complete MPEG-TS packets
+	segmentSize -= segmentSize % 188
+
+	buffer = &streamBuffer{Key: key, segmentSize: segmentSize, maxSegments: bufferSegments, done: make(chan struct{})}
+	buffer.cond = sync.NewCond(&buffer.mutex)
+
+	// The storage is fixed for the lifetime of the buffer, changes of the setting only affect new streams
+	var vfs = getBufferVFS()
+
+	b, loaded := streamBuffers.LoadOrStore(key, buffer)
+	if loaded {
+		return b.(*streamBuffer)
+	}
+
+	if !Settings.StoreBufferInRAM && vfs != nil {
+
+		var folder = "/" + key + "/"
+
+		if err := checkVFSFolder(folder, vfs); err != nil {
+			ShowError(err, 4008)
+			return
+		}
+
+		buffer.mutex.Lock()
+		buffer.vfs = vfs
+		buffer.folder = folder
+		buffer.mutex.Unlock()
+
+	}
+
+	return
+}
+
+// Write : Appends data to the current segment. Full segments are sealed and the oldest ones are removed.
+func (b *streamBuffer) Write(p []byte) (n int, err error) {
+
+	var removed []string
+	var sealed []*bufferSegment
+
+	b.mutex.Lock()
+
+	if b.closed {
+		b.mutex.Unlock()
+		return 0, errBufferClosed
+	}
+
+	var limit = b.segmentSize
+	if b.keyframes {
+		limit *= bufferKeyframeSegmentLimit
+	}
+
+	for len(p) > 0 {
+
+		var segment = b.currentSegment()
+
+		var free = limit - len(segment.Data)
+		if free > len(p) {
+			free = len(p)
+		}
+
+		segment.Data = append(segment.Data, p[:free]...)
+		segment.Size = len(segment.Data)
+		p = p[free:]
+		n += free
+
+		if len(segment.Data) >= limit {
+			removed = append(removed, b.seal(segment)...)
+			sealed = append(sealed, segment)
+		}
+
+	}
+
+	b.size += int64(n)
+	b.received += int64(n)
+	b.bandwidth.Add(n)
+	bufferBytes.Add(int64(n))
+
+	b.cond.Broadcast()
+	b.mutex.Unlock()
+
+	b.removeFiles(removed)
+	b.store(sealed...)
+
+	if quota := int64(Settings.BufferTotalQuota) * 1024 * 1024; quota > 0 && bufferBytes.Load() > quota {
+		enforceBufferQuota(quota)
+	}
+
+	return
+}
+
+// currentSegment : Segment which is being written, must be called with the lock held
+func (b *streamBuffer) currentSegment() (segment *bufferSegment) {
+
+	if len(b.segments) > 0 {
+
+		segment = b.segments[len(b.segments)-1]
+		if !segment.Sealed {
+			return
+		}
+
+	}
+
+	if b.discontinuity {
+		b.discontinuities++
+	}
+
+	segment = &bufferSegment{Sequence: b.sequence, Data: make([]byte, 0, b.segmentSize), Created: time.Now(), Discontinuity: b.discontinuity, DiscontinuitySequence: b.discontinuities, Keyframe: b.keyframe, Tables: b.tables}
+	b.sequence++
+	b.discontinuity = false
+	b.keyframe = false
+	b.segments = append(b.segments, segment)
+
+	return
+}
+
+// seal : Completes the segment, must be called with the lock held. Returns the segment files that have to be removed.
+func (b *streamBuffer) seal(segment *bufferSegment) (removed []string) {
+
+	segment.Sealed = true
+
+	// Playback duration of the segment, without timestamps in the data the time it took to receive the segment is used
+	if segment.Duration = getTSDuration(segment.Data); segment.Duration <= 0 {
+		segment.Duration = time.Since(segment.Created)
+	}
+
+	return b.evict(b.overQuota)
+}
+
+// Keyframe : The next data starts with a keyframe. The current segment is completed if it has reached the segment size
+// or if it does not start with a keyframe itself, so that new clients can start at the keyframe.
+func (b *streamBuffer) Keyframe() {
+
+	var removed []string
+	var sealed *bufferSegment
+
+	b.mutex.Lock()
+
+	b.keyframes = true
+	b.keyframe = true
+
+	if n := len(b.segments); n > 0 && !b.segments[n-1].Sealed && b.segments[n-1].Size > 0 {
+
+		var segment = b.segments[n-1]
+
+		if segment.Size >= b.segmentSize || !segment.Keyframe {
+			removed = b.seal(segment)
+			sealed = segment
+			b.cond.Broadcast()
+		} else {
+			b.keyframe = false
+		}
+
+	}
+
+	b.mutex.Unlock()
+
+	b.removeFiles(removed)
+
+	if sealed != nil {
+		b.store(sealed)
+	}
+
+}
+
+// SetTables : Latest PAT / PMT of the stream
+func (b *streamBuffer) SetTables(tables []byte) {
+
+	b.mutex.Lock()
+	b.tables = tables
+	b.mutex.Unlock()
+
+}
+
+// overQuota : Number of segments or size of the stream exceeds the limit, must be called with the lock held
+func (b *streamBuffer) overQuota() bool {
+
+	if b.window > 0 {
+
+		// The oldest segment is only removed if the remaining segments still cover the window
+		if len(b.segments) > 1 && time.Since(b.segments[1].Created) > b.window {
+			return true
+		}
+
+	} else if len(b.segments) > b.maxSegments {
+		return true
+	}
+
+	if quota := int64(Settings.BufferStreamQuota) * 1024 * 1024; quota > 0 && b.size > quota {
+		return true
+	}
+
+	return false
+}
+
+// evict : Removes the oldest segments as long as the condition is true. The newest completed segment is always kept.
+// Must be called with the lock held, returns the segment files that have to be removed.
+func (b *streamBuffer) evict(condition func() bool) (removed []string) {
+
+	for len(b.segments) > 1 && b.segments[1].Sealed && condition() {
+
+		var segment = b.segments[0]
+
+		b.size -= int64(segment.Size)
+		bufferBytes.Add(-int64(segment.Size))
+
+		if segment.Stored {
+			removed = append(removed, b.segmentFile(segment.Sequence))
+		}
+
+		b.segments[0] = nil
+		b.segments = b.segments[1:]
+
+	}
+
+	return
+}
+
+// store : Writes the segments that were just completed into the filesystem of the buffer (disk buffer)
+func (b *streamBuffer) store(segments ...*bufferSegment) {
+
+	if b.vfs == nil {
+		return
+	}
+
+	for _, segment := range segments {
+
+		// The data of a completed segment is not changed anymore, it can be written without the lock
+		var fileName = b.segmentFile(segment.Sequence)
+
+		if err := b.vfs.WriteFile(fileName, segment.Data, 0600); err != nil {
+			ShowError(err, 4008)
+			continue
+		}
+
+		b.mutex.Lock()
+		if b.closed || len(b.segments) == 0 || b.segments[0].Sequence > segment.Sequence {
+			b.mutex.Unlock()
+			b.vfs.Remove(fileName)
+			continue
+		}
+		segment.Stored = true
+		segment.Data = nil
+		b.mutex.Unlock()
+
+	}
+
+}
+
+// removeFiles : Removes segment files of the buffer
+func (b *streamBuffer) removeFiles(files []string) {
+
+	for _, fileName := range files {
+		if err := b.vfs.Remove(fileName); err != nil && !fsIsNotExistErr(err) {
+			ShowError(err, 4007)
+		}
+	}
+
+}
+
+// segmentFile : File name of a segment (disk buffer)
+func (b *streamBuffer) segmentFile(sequence int64) string {
+	return fmt.Sprintf("%s%d.ts", b.folder, sequence)
+}
+
+// Discontinuity : The following data comes from another source. The current segment is completed, so that the new source starts with a new segment.
+func (b *streamBuffer) Discontinuity() {
+
+	var removed []string
+	var sealed *bufferSegment
+
+	b.mutex.Lock()
+
+	if n := len(b.segments); n > 0 && !b.segments[n-1].Sealed && b.segments[n-1].Size > 0 {
+		sealed = b.segments[n-1]
+		removed = b.seal(sealed)
+	}
+
+	b.discontinuity = true
+	b.keyframe = false
+
+	b.cond.Broadcast()
+	b.mutex.Unlock()
+
+	b.removeFiles(removed)
+
+	if sealed != nil {
+		b.store(sealed)
+	}
+
+}
+
+// Bandwidth : Ingress bandwidth (bit/s, rolling average) and data that was written into the buffer
+func (b *streamBuffer) Bandwidth() (bitrate int, received int64) {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.bandwidth.Add(0)
+
+	return b.bandwidth.NetworkBandwidth, b.received
+}
+
+// SetTimeShift : Keeps the segments for the duration of the window, 0 keeps the default number of segments
+func (b *streamBuffer) SetTimeShift(window time.Duration) {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.window = window
+
+	if window <= 0 || b.vfs != nil {
+		return
+	}
+
+	// The time shift window is always kept on disk, also if the buffer is stored in RAM
+	var folder = "/" + b.Key + "/"
+
+	vfs, err := newDiskVFS()
+	if err == nil {
+		err = checkVFSFolder(folder, vfs)
+	}
+
+	if err != nil {
+		ShowError(err, 4008)
+		return
+	}
+
+	b.vfs = vfs
+	b.folder = folder
+
+}
+
+// Ready : At least one segment has been completed
+func (b *streamBuffer) Ready() bool {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, segment := range b.segments {
+		if segment.Sealed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WaitReady : Waits until the first segment has been completed
+func (b *streamBuffer) WaitReady(ctx context.Context) (err error) {
+
+	var stop = context.AfterFunc(ctx, func() {
+		b.mutex.Lock()
+		b.cond.Broadcast()
+		b.mutex.Unlock()
+	})
+	defer stop()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for {
+
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		if b.closed {
+
+			err = b.err
+			if err == nil {
+				err = errBufferClosed
+			}
+
+			return
+		}
+
+		for _, segment := range b.segments {
+			if segment.Sealed {
+				return nil
+			}
+		}
+
+		b.cond.Wait()
+
+	}
+
+}
+
+// Segments : Information about the newest completed segments (without data)
+func (b *streamBuffer) Segments(count int) (segments []bufferSegment) {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for i := len(b.segments) - 1; i >= 0 && len(segments) < count; i-- {
+
+		var segment = b.segments[i]
+		if !segment.Sealed {
+			continue
+		}
+
+		segments = append([]bufferSegment{{Sequence: segment.Sequence, Size: segment.Size, Created: segment.Created, Duration: segment.Duration, Sealed: true, Discontinuity: segment.Discontinuity, DiscontinuitySequence: segment.DiscontinuitySequence}}, segments...)
+
+	}
+
+	return
+}
+
+// SegmentData : Data of a completed segment. MPEG-TS segments start with the PAT / PMT, so that every segment can be decoded on its own (HLS).
+func (b *streamBuffer) SegmentData(sequence int64) (data []byte, err error) {
+
+	b.mutex.Lock()
+
+	for _, segment := range b.segments {
+
+		if segment.Sequence != sequence || !segment.Sealed {
+			continue
+		}
+
+		var tables = segment.Tables
+
+		if !segment.Stored {
+
+			data = segment.Data
+			if len(tables) > 0 {
+				data = append(append(make([]byte, 0, len(tables)+segment.Size), tables...), segment.Data...)
+			}
+
+			b.mutex.Unlock()
+			return
+		}
+
+		b.mutex.Unlock()
+
+		if data, err = b.vfs.ReadFile(b.segmentFile(sequence)); err == nil && len(tables) > 0 {
+			data = append(append(make([]byte, 0, len(tables)+len(data)), tables...), data...)
+		}
+
+		return
+
+	}
+
+	b.mutex.Unlock()
+
+	err = fmt.Errorf("Segment %d is not available", sequence)
+
+	return
+}
+
+// Close : Stops the ring buffer and removes all segments, waiting readers receive the error
+func (b *streamBuffer) Close(err error) {
+
+	streamBuffers.CompareAndDelete(b.Key, b)
+
+	b.mutex.Lock()
+
+	if b.closed {
+		b.mutex.Unlock()
+		return
+	}
+
+	b.closed = true
+	b.err = err
+	close(b.done)
+
+	bufferBytes.Add(-b.size)
+	b.size = 0
+	b.segments = nil
+
+	b.cond.Broadcast()
+	b.mutex.Unlock()
+
+	if b.vfs != nil {
+
+		if err := b.vfs.RemoveAll(b.folder); err != nil {
+			ShowError(err, 4005)
+		}
+
+	}
+
+}
+
+// Done : Is closed when the buffer is closed (no more clients, error of all sources or stopped stream)
+func (b *streamBuffer) Done() <-chan struct{} {
+	return b.done
+}
+
+// Closed : The buffer was closed
+func (b *streamBuffer) Closed() bool {
+
+	select {
+
+	case <-b.done:
+		return true
+
+	default:
+		return false
+
+	}
+
+}
+
+// NewReader : Creates a cursor at the most recent complete segment. MPEG-TS streams start at the most recent segment
+// that starts with a keyframe, the client receives the PAT / PMT first.
+func (b *streamBuffer) NewReader(ctx context.Context) (reader *bufferReader) {
+
+	reader = &bufferReader{buffer: b, ctx: ctx, fileSeq: -1}
+
+	b.mutex.Lock()
+
+	reader.sequence = b.sequence
+	for i := len(b.segments) - 1; i >= 0; i-- {
+
+		reader.sequence = b.segments[i].Sequence
+		if b.segments[i].Sealed {
+			break
+		}
+
+	}
+
+	if b.keyframes {
+
+		var start *bufferSegment
+
+		for i := len(b.segments) - 1; i >= 0; i-- {
+
+			var segment = b.segments[i]
+			if !segment.Keyframe {
+				continue
+			}
+
+			// The current segment is only used if no completed segment starts with a keyframe
+			start = segment
+			if segment.Sealed {
+				break
+			}
+
+		}
+
+		if start != nil {
+			reader.sequence = start.Sequence
+			reader.prefix = start.Tables
+		}
+
+	}
+
+	b.mutex.Unlock()
+
+	// Wake up the reader when the client has disconnected
+	reader.stop = context.AfterFunc(ctx, func() {
+		b.mutex.Lock()
+		b.cond.Broadcast()
+		b.mutex.Unlock()
+	})
+
+	return
+}
+
+// Seek : Moves the cursor to the segment that was received at the offset (negative) from now.
+// If the offset is outside of the time shift window, the oldest segment is used.
+func (r *bufferReader) Seek(offset time.Duration) {
+
+	var b = r.buffer
+	var target = time.Now().Add(offset)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.segments) == 0 {
+		return
+	}
+
+	var start = b.segments[0]
+
+	for _, segment := range b.segments {
+
+		if segment.Created.After(target) {
+			break
+		}
+
+		// MPEG-TS streams start at a keyframe
+		if segment.Keyframe || !b.keyframes || !start.Keyframe {
+			start = segment
+		}
+
+	}
+
+	r.sequence = start.Sequence
+	r.offset = 0
+	r.prefix = start.Tables
+
+}
+
+// Read : Returns the next data for the reader, waits until new data is available
+func (r *bufferReader) Read() (data []byte, err error) {
+
+	var b = r.buffer
+
+	// PAT / PMT before the first segment
+	if len(r.prefix) > 0 {
+		data, r.prefix = r.prefix, nil
+		return
+	}
+
+	b.mutex.Lock()
+
+	for {
+
+		if err = r.ctx.Err(); err != nil {
+			b.mutex.Unlock()
+			return
+		}
+
+		if len(b.segments) > 0 {
+
+			var first = b.segments[0].Sequence
+
+			// The reader was too slow, the segment has already been removed
+			if r.sequence < first {
+				showDebug("Buffer Status:Client is too slow, skipping to the oldest segment", 2)
+				r.sequence = first
+				r.offset = 0
+
+				if len(b.segments[0].Tables) > 0 {
+					data = b.segments[0].Tables
+					b.mutex.Unlock()
+					return
+				}
+			}
+
+			if i := int(r.sequence - first); i < len(b.segments) {
+
+				var segment = b.segments[i]
+
+				if r.offset < segment.Size {
+
+					if segment.Stored {
+
+						var sequence, offset = segment.Sequence, r.offset
+						b.mutex.Unlock()
+
+						data, err = r.readFile(sequence, offset)
+						if err == nil {
+							r.offset += len(data)
+							return
+						}
+
+						// Segment was removed in the meantime
+						b.mutex.Lock()
+						if r.sequence == sequence {
+							r.sequence++
+							r.offset = 0
+						}
+						continue
+
+					}
+
+					data = segment.Data[r.offset:segment.Size]
+					r.offset = segment.Size
+					b.mutex.Unlock()
+					return
+				}
+
+				if segment.Sealed {
+					r.sequence++
+					r.offset = 0
+					continue
+				}
+
+			}
+
+		}
+
+		if b.closed {
+
+			err = b.err
+			if err == nil {
+				err = io.EOF
+			}
+
+			b.mutex.Unlock()
+			return
+		}
+
+		b.cond.Wait()
+
+	}
+
+}
+
+// readFile : Reads the next chunk of a segment file (disk buffer)
+func (r *bufferReader) readFile(sequence int64, offset int) (data []byte, err error) {
+
+	if r.file == nil || r.fileSeq != sequence {
+
+		r.closeFile()
+
+		r.file, err = r.buffer.vfs.OpenFile(r.buffer.segmentFile(sequence), os.O_RDONLY, 0)
+		if err != nil {
+			return
+		}
+
+		r.fileSeq = sequence
+
+	}
+
+	if r.fileData == nil {
+		r.fileData = make([]byte, bufferReadSize)
+	}
+
+	n, err := r.file.ReadAt(r.fileData, int64(offset))
+	if n > 0 {
+		return r.fileData[:n], nil
+	}
+
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return
+}
+
+// closeFile : Closes the segment file of the reader
+func (r *bufferReader) closeFile() {
+
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+		r.fileSeq = -1
+	}
+
+}
+
+// Close : Removes the reader
+func (r *bufferReader) Close() {
+
+	if r.stop != nil {
+		r.stop()
+	}
+
+	r.closeFile()
+
+}
+
+// enforceBufferQuota : Removes the oldest segments of all buffers until the size of all buffers is within the quota
+func enforceBufferQuota(quota int64) {
+
+	for bufferBytes.Load() > quota {
+
+		var oldest *streamBuffer
+		var created time.Time
+
+		streamBuffers.Range(func(_, value interface{}) bool {
+
+			var b = value.(*streamBuffer)
+
+			b.mutex.Lock()
+			if len(b.segments) > 1 && b.segments[1].Sealed {
+				if oldest == nil || b.segments[0].Created.Before(created) {
+					oldest = b
+					created = b.segments[0].Created
+				}
+			}
+			b.mutex.Unlock()
+
+			return true
+		})
+
+		if oldest == nil {
+			return
+		}
+
+		var evicted bool
+
+		oldest.mutex.Lock()
+		var removed = oldest.evict(func() bool {
+			if evicted {
+				return false
+			}
+			evicted = true
+			return true
+		})
+		oldest.mutex.Unlock()
+
+		oldest.removeFiles(removed)
+
+		if !evicted {
+			return
+		}
+
+	}
+
+}
+
+// cleanupBufferFolders : Removes folders of the disk buffer which no longer belong to a stream
+func cleanupBufferFolders() {
+
+	var tmpFolder = getPlatformPath(System.Folder.Temp)
+
+	entries, err := os.ReadDir(tmpFolder)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+
+		if _, ok := streamBuffers.Load(entry.Name()); ok {
+			continue
+		}
+
+		var debug = fmt.Sprintf("Buffer:Remove orphaned buffer folder (%s)", entry.Name())
+		showDebug(debug, 1)
+
+		if err := os.RemoveAll(tmpFolder + entry.Name()); err != nil {
+			ShowError(err, 4005)
+		}
+
+	}
+
+}
+
+// getTimeShift : Time shift window of a channel in minutes, without a value for the channel the global setting is used
+func getTimeShift(channelTimeShift string) (minutes int) {
+
+	minutes = Settings.BufferTimeShift
+
+	if i, err := strconv.Atoi(strings.TrimSpace(channelTimeShift)); err == nil && i >= 0 {
+		minutes = i
+	}
+
+	return
+}
@@ -0,0 +1,388 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// testSegmentSize : Segment size of the test buffers, 10 MPEG-TS packets
+const testSegmentSize = 10 * tsPacketSize
+
+// newTestData : Data with a pattern, so that a wrong offset is noticed
+func newTestData(size int) []byte {
+
+	var data = make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	return data
+}
+
+func TestStreamBufferWrite(t *testing.T) {
+
+	var tests = []struct {
+		name        string
+		maxSegments int
+		writes      []int
+		segments    int
+		first       int64
+		sealed      int
+	}{
+		{
+			name:        "incomplete segment",
+			maxSegments: 3,
+			writes:      []int{1000},
+			segments:    1,
+			first:       0,
+			sealed:      0,
+		},
+		{
+			name:        "full segment is sealed",
+			maxSegments: 3,
+			writes:      []int{1000, testSegmentSize - 1000},
+			segments:    1,
+			first:       0,
+			sealed:      1,
+		},
+		{
+			name:        "write across segments",
+			maxSegments: 3,
+			writes:      []int{2*testSegmentSize + 100},
+			segments:    3,
+			first:       0,
+			sealed:      2,
+		},
+		{
+			name:        "oldest segments are removed",
+			maxSegments: 3,
+			writes:      []int{testSegmentSize, 4 * testSegmentSize, testSegmentSize},
+			segments:    3,
+			first:       3,
+			sealed:      3,
+		},
+		{
+			name:        "newest completed segment is kept",
+			maxSegments: 0,
+			writes:      []int{2*testSegmentSize + 100},
+			segments:    2,
+			first:       1,
+			sealed:      1,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			var buffer = newTestBuffer(testSegmentSize, test.maxSegments)
+			defer buffer.Close(nil)
+
+			for _, size := range test.writes {
+
+				if n, err := buffer.Write(newTestData(size)); err != nil || n != size {
+					t.Fatalf("Write() = %d, %v, want %d, nil", n, err, size)
+				}
+
+			}
+
+			var sealed, size int
+
+			for _, segment := range buffer.segments {
+
+				if segment.Sealed {
+					sealed++
+				}
+
+				size += segment.Size
+
+			}
+
+			if len(buffer.segments) != test.segments || buffer.segments[0].Sequence != test.first || sealed != test.sealed {
+				t.Errorf("segments = %d, first = %d, sealed = %d, want %d, %d, %d", len(buffer.segments), buffer.segments[0].Sequence, sealed, test.segments, test.first, test.sealed)
+			}
+
+			if buffer.size != int64(size) {
+				t.Errorf("size = %d, want %d", buffer.size, size)
+			}
+
+		})
+
+	}
+
+}
+
+func TestBufferReader(t *testing.T) {
+
+	var tests = []struct {
+		name        string
+		maxSegments int
+		before      int // Data written before the reader is created
+		after       int // Data written after the reader is created
+		start       int // Offset of the first data the reader receives
+	}{
+		{
+			name:        "newest completed segment",
+			maxSegments: bufferSegments,
+			before:      2*testSegmentSize + 100,
+			after:       testSegmentSize,
+			start:       testSegmentSize,
+		},
+		{
+			name:        "no completed segment",
+			maxSegments: bufferSegments,
+			before:      100,
+			after:       testSegmentSize,
+			start:       0,
+		},
+		{
+			name:        "empty buffer",
+			maxSegments: bufferSegments,
+			before:      0,
+			after:       2 * testSegmentSize,
+			start:       0,
+		},
+		{
+			name:        "slow reader",
+			maxSegments: 2,
+			before:      0,
+			after:       5 * testSegmentSize,
+			start:       3 * testSegmentSize,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			var data = newTestData(test.before + test.after)
+
+			var buffer = newTestBuffer(testSegmentSize, test.maxSegments)
+			defer buffer.Close(nil)
+
+			buffer.Write(data[:test.before])
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			var reader = buffer.NewReader(ctx)
+			defer reader.Close()
+
+			buffer.Write(data[test.before:])
+
+			var want = data[test.start:]
+			var got []byte
+
+			for len(got) < len(want) {
+
+				chunk, err := reader.Read()
+				if err != nil {
+					t.Fatalf("Read() error = %v after %d bytes, want %d bytes", err, len(got), len(want))
+				}
+
+				got = append(got, chunk...)
+
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("reader received %d bytes that differ from the data at offset %d", len(got), test.start)
+			}
+
+		})
+
+	}
+
+}
+
+func TestStreamBufferQuota(t *testing.T) {
+
+	var quota = Settings.BufferStreamQuota
+	defer func() { Settings.BufferStreamQuota = quota }()
+
+	// 10 segments of 188 KB. The quota is checked when a segment is completed, before its size is added, so 6 segments remain with 1 MB.
+	const segmentSize = 1000 * tsPacketSize
+
+	var tests = []struct {
+		name     string
+		quota    int
+		segments int
+	}{
+		{
+			name:     "without quota",
+			quota:    0,
+			segments: 10,
+		},
+		{
+			name:     "stream quota",
+			quota:    1,
+			segments: 6,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			Settings.BufferStreamQuota = test.quota
+
+			var buffer = newTestBuffer(segmentSize, bufferSegments)
+			defer buffer.Close(nil)
+
+			for i := 0; i < 10; i++ {
+				buffer.Write(newTestData(segmentSize))
+			}
+
+			if len(buffer.segments) != test.segments {
+				t.Errorf("segments = %d, want %d", len(buffer.segments), test.segments)
+			}
+
+		})
+
+	}
+
+}
+
+func TestStreamBufferTimeShift(t *testing.T) {
+
+	// Segments received 5, 4 and 3 minutes and 30 and 10 seconds ago
+	var ages = []time.Duration{5 * time.Minute, 4 * time.Minute, 3 * time.Minute, 30 * time.Second, 10 * time.Second}
+
+	var tests = []struct {
+		name        string
+		window      time.Duration
+		maxSegments int
+		first       int64
+	}{
+		{
+			name:        "without window",
+			window:      0,
+			maxSegments: 3,
+			first:       2,
+		},
+		{
+			name:        "segments cover the window",
+			window:      time.Minute,
+			maxSegments: 1,
+			first:       2,
+		},
+		{
+			name:        "window longer than the buffer",
+			window:      10 * time.Minute,
+			maxSegments: 1,
+			first:       0,
+		},
+		{
+			name:        "short window",
+			window:      20 * time.Second,
+			maxSegments: 1,
+			first:       3,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			var buffer = newTestBuffer(testSegmentSize, test.maxSegments)
+			buffer.window = test.window
+
+			for i, age := range ages {
+				buffer.segments = append(buffer.segments, &bufferSegment{Sequence: int64(i), Created: time.Now().Add(-age), Sealed: true})
+			}
+
+			buffer.mutex.Lock()
+			buffer.evict(buffer.overQuota)
+			buffer.mutex.Unlock()
+
+			if first := buffer.segments[0].Sequence; first != test.first {
+				t.Errorf("first segment = %d, want %d", first, test.first)
+			}
+
+		})
+
+	}
+
+}
+
+func TestBufferReaderSeek(t *testing.T) {
+
+	var tests = []struct {
+		name      string
+		keyframes []bool
+		offset    time.Duration
+		sequence  int64
+	}{
+		{
+			name:     "segment at the offset",
+			offset:   -35 * time.Second,
+			sequence: 11,
+		},
+		{
+			name:     "newest segment",
+			offset:   0,
+			sequence: 14,
+		},
+		{
+			name:     "offset outside of the window",
+			offset:   -5 * time.Minute,
+			sequence: 10,
+		},
+		{
+			name:      "keyframe before the offset",
+			keyframes: []bool{true, false, true, false, true},
+			offset:    -35 * time.Second,
+			sequence:  10,
+		},
+		{
+			name:      "latest keyframe before the offset",
+			keyframes: []bool{true, false, true, false, true},
+			offset:    -15 * time.Second,
+			sequence:  12,
+		},
+		{
+			name:      "offset outside of the window with keyframes",
+			keyframes: []bool{false, true, false, false, true},
+			offset:    -5 * time.Minute,
+			sequence:  10,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			var buffer = newTestBuffer(testSegmentSize, bufferSegments)
+			buffer.keyframes = test.keyframes != nil
+
+			// Segments 10 - 14, received 50, 40, 30, 20 and 10 seconds ago
+			for i := 0; i < 5; i++ {
+
+				var segment = &bufferSegment{Sequence: int64(10 + i), Created: time.Now().Add(time.Duration(i-5) * 10 * time.Second), Sealed: true, Tables: []byte{byte(10 + i)}}
+				if buffer.keyframes {
+					segment.Keyframe = test.keyframes[i]
+				}
+
+				buffer.segments = append(buffer.segments, segment)
+
+			}
+
+			var reader = buffer.NewReader(context.Background())
+			defer reader.Close()
+
+			reader.Seek(test.offset)
+
+			if reader.sequence != test.sequence || reader.offset != 0 {
+				t.Errorf("sequence = %d, offset = %d, want %d, 0", reader.sequence, reader.offset, test.sequence)
+			}
+
+			if !bytes.Equal(reader.prefix, []byte{byte(test.sequence)}) {
+				t.Errorf("prefix = %v, want the tables of segment %d", reader.prefix, test.sequence)
+			}
+
+		})
+
+	}
+
+}
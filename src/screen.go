@@ -307,6 +307,8 @@ func getErrMsg(errCode int) (errMsg string) {
 		errMsg = fmt.Sprintf("Steaming URL could not be found in any playlist")
 	case 1204:
 		errMsg = fmt.Sprintf("Streaming was stopped by third party transcoder (FFmpeg / VLC)")
+	case 1205:
+		errMsg = fmt.Sprintf("Streaming URL was rejected, signed streaming URLs are enabled")
 
 	// Warnings
 	case 2000:
@@ -369,6 +371,10 @@ func getErrMsg(errCode int) (errMsg string) {
 		errMsg = fmt.Sprintf("Server connection timeout")
 	case 4007:
 		errMsg = fmt.Sprintf("Old temporary buffer file could not be deleted")
+	case 4008:
+		errMsg = fmt.Sprintf("Temporary buffer file could not be written, the buffer is stored in RAM")
+	case 4009:
+		errMsg = fmt.Sprintf("Slate could not be created with FFmpeg")
 
 	// Buffer (M3U8)
 	case 4050:
@@ -385,6 +391,10 @@ func getErrMsg(errCode int) (errMsg string) {
 	// API
 	case 5000:
 		errMsg = fmt.Sprintf("Invalid API command")
+	case 5001:
+		errMsg = fmt.Sprintf("Session not found")
+	case 5002:
+		errMsg = fmt.Sprintf("Recording not found")
 
 	default:
 		errMsg = fmt.Sprintf("Unknown error / warning (%d)", errCode)
@@ -0,0 +1,186 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StreamSession : Client that is connected to a stream (TS or HLS)
+type StreamSession struct {
+	ID         string        `json:"id"`
+	Type       string        `json:"type"` // stream, hls
+	ClientIP   string        `json:"clientIP"`
+	UserAgent  string        `json:"userAgent"`
+	User       string        `json:"user"`
+	Channel    string        `json:"channel"`
+	PlaylistID string        `json:"playlistID"`
+	Provider   string        `json:"provider"`
+	Started    time.Time     `json:"started"`
+	BytesSent  int64         `json:"bytesSent"`
+	Bitrate    int           `json:"bitrate"`         // Egress bandwidth to the client (bit/s, rolling average)
+	BitrateIn  int           `json:"upstreamBitrate"` // Ingress bandwidth of the upstream (bit/s, rolling average)
+	Source     string        `json:"source"`          // Primary, Backup 1, 2, ...
+	Upstream   string        `json:"upstream"`
+	History    []StreamEvent `json:"history"` // Events of the upstream since the client is connected
+
+	streamID  int
+	sent      int64
+	bandwidth BandwidthCalculation
+	kill      func()
+	mutex     *sync.Mutex
+}
+
+// streamSessions : Active clients of all streams (session ID)
+var streamSessions sync.Map
+
+// newStreamSession : Registers a client of the stream. The kill function disconnects the client.
+func newStreamSession(sessionType, playlistID string, streamID int, channelName string, r *http.Request, kill func()) (session *StreamSession) {
+
+	session = &StreamSession{
+		ID:         randomString(16),
+		Type:       sessionType,
+		ClientIP:   getClientIP(r),
+		UserAgent:  r.UserAgent(),
+		User:       getRequestUser(r),
+		Channel:    channelName,
+		PlaylistID: playlistID,
+		Provider:   getProviderParameter(playlistID, getPlaylistType(playlistID), "name"),
+		Started:    time.Now(),
+		streamID:   streamID,
+		kill:       kill,
+		mutex:      &sync.Mutex{},
+	}
+
+	streamSessions.Store(session.ID, session)
+
+	showDebug(fmt.Sprintf("Session:%s - Channel: %s - Client: %s", session.ID, session.Channel, session.ClientIP), 2)
+
+	return
+}
+
+// Sent : Data that was sent to the client
+func (session *StreamSession) Sent(n int) {
+
+	atomic.AddInt64(&session.sent, int64(n))
+
+	session.mutex.Lock()
+	session.bandwidth.Add(n)
+	session.mutex.Unlock()
+
+}
+
+// Bandwidth : Egress bandwidth to the client (bit/s, rolling average)
+func (session *StreamSession) Bandwidth() int {
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	session.bandwidth.Add(0)
+
+	return session.bandwidth.NetworkBandwidth
+}
+
+// Close : Removes the client from the registry
+func (session *StreamSession) Close() {
+	streamSessions.Delete(session.ID)
+}
+
+// getStreamSessions : All active clients, sorted by start time. The current upstream is taken from the buffer information.
+func getStreamSessions() (sessions []StreamSession) {
+
+	sessions = make([]StreamSession, 0)
+
+	streamSessions.Range(func(_, value interface{}) bool {
+
+		var session = value.(*StreamSession)
+
+		var s = StreamSession{
+			ID:         session.ID,
+			Type:       session.Type,
+			ClientIP:   session.ClientIP,
+			UserAgent:  session.UserAgent,
+			User:       session.User,
+			Channel:    session.Channel,
+			PlaylistID: session.PlaylistID,
+			Provider:   session.Provider,
+			Started:    session.Started,
+			BytesSent:  atomic.LoadInt64(&session.sent),
+			Bitrate:    session.Bandwidth(),
+			History:    make([]StreamEvent, 0),
+		}
+
+		Lock.RLock()
+		if p, ok := BufferInformation.Load(session.PlaylistID); ok {
+
+			if stream, ok := p.(*Playlist).Streams[session.streamID]; ok {
+				s.Source = stream.Source
+				s.Upstream = stream.SourceURL
+				s.BitrateIn = stream.NetworkBandwidth
+
+				for _, event := range stream.History {
+
+					if !event.Time.Before(session.Started) {
+						s.History = append(s.History, event)
+					}
+
+				}
+			}
+
+		}
+		Lock.RUnlock()
+
+		sessions = append(sessions, s)
+
+		return true
+	})
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Started.Before(sessions[j].Started)
+	})
+
+	return
+}
+
+// killStreamSession : Disconnects a client, the tuner is released as soon as the stream has no more clients
+func killStreamSession(id string) (err error) {
+
+	s, ok := streamSessions.Load(id)
+	if !ok {
+		err = errors.New(getErrMsg(5001))
+		return
+	}
+
+	var session = s.(*StreamSession)
+
+	showInfo(fmt.Sprintf("Session:%s - Channel: %s - Client: %s was disconnected", session.ID, session.Channel, session.ClientIP))
+
+	session.Close()
+	session.kill()
+
+	return
+}
+
+// StreamEvent : Change of the upstream of a stream (restart, failover, failback)
+type StreamEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+}
+
+// Maximum number of events that are kept for a stream
+const streamHistoryLimit = 50
+
+// addEvent : Adds an event to the history of the stream, the oldest events are removed
+func (stream *ThisStream) addEvent(event string) {
+
+	stream.History = append(stream.History, StreamEvent{Time: time.Now(), Event: event})
+
+	if len(stream.History) > streamHistoryLimit {
+		stream.History = stream.History[len(stream.History)-streamHistoryLimit:]
+	}
+
+}
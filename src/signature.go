@@ -0,0 +1,107 @@
+package src
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Validity of signed streaming URLs in hours, if the setting is not valid
+const defaultStreamSigningExpiry = 24
+
+// streamUserKey : Context key for the user of a signed streaming URL
+type streamUserKey struct{}
+
+// signStreamingURL : Adds the expiry and the HMAC signature to a streaming URL (stream.signing). The user is optional, the URL is then bound to this user.
+func signStreamingURL(streamingURL, urlID, user string) string {
+
+	if !Settings.StreamSigning {
+		return streamingURL
+	}
+
+	var validity = Settings.StreamSigningExpiry
+	if validity <= 0 {
+		validity = defaultStreamSigningExpiry
+	}
+
+	var expires = time.Now().Add(time.Duration(validity) * time.Hour).Unix()
+
+	var query = url.Values{}
+	query.Set("exp", strconv.FormatInt(expires, 10))
+
+	if len(user) > 0 {
+		query.Set("user", user)
+	}
+
+	query.Set("sig", getStreamSignature(urlID, expires, user))
+
+	return streamingURL + "?" + query.Encode()
+}
+
+// getStreamSignature : HMAC-SHA256 of the URL ID, the expiry and the user
+func getStreamSignature(urlID string, expires int64, user string) string {
+
+	var mac = hmac.New(sha256.New, []byte(Settings.StreamSigningSecret))
+	mac.Write([]byte(fmt.Sprintf("%s|%d|%s", urlID, expires, user)))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyStreamingURL : Checks the signature of a streaming URL. Expired URLs are accepted during the grace period (stream.signing.grace.hours),
+// for clients like Plex that keep the lineup for a long time. The user of the URL is added to the context of the request.
+func verifyStreamingURL(urlID string, r *http.Request) (request *http.Request, err error) {
+
+	request = r
+
+	if !Settings.StreamSigning {
+		return
+	}
+
+	var query = r.URL.Query()
+	var user = query.Get("user")
+
+	expires, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil || len(query.Get("sig")) == 0 {
+		err = errors.New("Streaming URL is not signed")
+		return
+	}
+
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(getStreamSignature(urlID, expires, user))) {
+		err = errors.New("Invalid signature")
+		return
+	}
+
+	var expiry = time.Unix(expires, 0)
+
+	if time.Now().After(expiry) {
+
+		if time.Now().After(expiry.Add(time.Duration(Settings.StreamSigningGrace) * time.Hour)) {
+			err = fmt.Errorf("Streaming URL expired at %s", expiry.Format("2006-01-02 15:04:05"))
+			return
+		}
+
+		showDebug(fmt.Sprintf("Streaming Status:Streaming URL expired at %s, accepted within the grace period", expiry.Format("2006-01-02 15:04:05")), 1)
+
+	}
+
+	if len(user) > 0 {
+
+		// Deleted users can no longer use their URLs
+		if !userExists(user) {
+			err = fmt.Errorf("User %s does not exist", user)
+			return
+		}
+
+		request = r.WithContext(context.WithValue(r.Context(), streamUserKey{}, user))
+
+	}
+
+	return
+}
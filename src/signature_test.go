@@ -0,0 +1,197 @@
+package src
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignStreamingURL(t *testing.T) {
+
+	var settings = Settings
+	defer func() { Settings = settings }()
+
+	Settings.StreamSigningSecret = "secret"
+	Settings.StreamSigningExpiry = 0
+
+	var tests = []struct {
+		name    string
+		signing bool
+		user    string
+		signed  bool
+	}{
+		{
+			name:    "signing disabled",
+			signing: false,
+			signed:  false,
+		},
+		{
+			name:    "signed",
+			signing: true,
+			signed:  true,
+		},
+		{
+			name:    "signed for a user",
+			signing: true,
+			user:    "alice",
+			signed:  true,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			Settings.StreamSigning = test.signing
+
+			var streamingURL = signStreamingURL("http://threadfin.local/stream/abc", "abc", test.user)
+
+			if !test.signed {
+
+				if streamingURL != "http://threadfin.local/stream/abc" {
+					t.Errorf("signStreamingURL() = %s, want the URL unchanged", streamingURL)
+				}
+
+				return
+			}
+
+			u, err := url.Parse(streamingURL)
+			if err != nil {
+				t.Fatalf("signStreamingURL() = %s: %v", streamingURL, err)
+			}
+
+			var query = u.Query()
+			expires, _ := strconv.ParseInt(query.Get("exp"), 10, 64)
+
+			// Default validity of 24 hours
+			if expiry := time.Until(time.Unix(expires, 0)); expiry < 23*time.Hour || expiry > 24*time.Hour {
+				t.Errorf("URL expires in %s, want 24h", expiry)
+			}
+
+			if query.Get("user") != test.user || query.Get("sig") != getStreamSignature("abc", expires, test.user) {
+				t.Errorf("signStreamingURL() = %s, user or signature do not match", streamingURL)
+			}
+
+		})
+
+	}
+
+}
+
+func TestVerifyStreamingURL(t *testing.T) {
+
+	var settings = Settings
+	defer func() { Settings = settings }()
+
+	Settings.StreamSigningSecret = "secret"
+
+	// signedQuery : Query of a streaming URL that was signed for the URL ID and expiry
+	var signedQuery = func(urlID string, expires time.Time, user string) string {
+
+		var query = url.Values{}
+		query.Set("exp", strconv.FormatInt(expires.Unix(), 10))
+		query.Set("sig", getStreamSignature(urlID, expires.Unix(), user))
+
+		if len(user) > 0 {
+			query.Set("user", user)
+		}
+
+		return query.Encode()
+	}
+
+	var valid = time.Now().Add(time.Hour)
+	var expired = time.Now().Add(-time.Hour)
+
+	var tests = []struct {
+		name    string
+		signing bool
+		grace   int
+		query   string
+		err     string
+	}{
+		{
+			name:    "signing disabled",
+			signing: false,
+			query:   "",
+		},
+		{
+			name:    "valid signature",
+			signing: true,
+			query:   signedQuery("abc", valid, ""),
+		},
+		{
+			name:    "not signed",
+			signing: true,
+			query:   "",
+			err:     "not signed",
+		},
+		{
+			name:    "signature of another URL",
+			signing: true,
+			query:   signedQuery("abd", valid, ""),
+			err:     "Invalid signature",
+		},
+		{
+			name:    "extended expiry",
+			signing: true,
+			query:   strings.Replace(signedQuery("abc", valid, ""), strconv.FormatInt(valid.Unix(), 10), strconv.FormatInt(valid.Add(time.Hour).Unix(), 10), 1),
+			err:     "Invalid signature",
+		},
+		{
+			name:    "user added to the URL",
+			signing: true,
+			query:   signedQuery("abc", valid, "") + "&user=alice",
+			err:     "Invalid signature",
+		},
+		{
+			name:    "expired",
+			signing: true,
+			query:   signedQuery("abc", expired, ""),
+			err:     "expired",
+		},
+		{
+			name:    "expired within the grace period",
+			signing: true,
+			grace:   2,
+			query:   signedQuery("abc", expired, ""),
+		},
+		{
+			name:    "unknown user",
+			signing: true,
+			query:   signedQuery("abc", valid, "alice"),
+			err:     "does not exist",
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			Settings.StreamSigning = test.signing
+			Settings.StreamSigningGrace = test.grace
+
+			var r = httptest.NewRequest("GET", "/stream/abc?"+test.query, nil)
+
+			request, err := verifyStreamingURL("abc", r)
+
+			if len(test.err) > 0 {
+
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("verifyStreamingURL() error = %v, want %q", err, test.err)
+				}
+
+				return
+			}
+
+			if err != nil || request == nil {
+				t.Errorf("verifyStreamingURL() error = %v, want nil", err)
+			}
+
+		})
+
+	}
+
+}
@@ -0,0 +1,424 @@
+package src
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Slates : Videos that are sent to the clients instead of the stream
+const (
+	slateTunerLimit      = "tuner-limit"      // No tuner is available
+	slateChannelOffline  = "channel-offline"  // No source of the channel delivers data
+	slateUpstreamFailure = "upstream-failure" // All sources of a running stream failed
+	slateReconnecting    = "reconnecting"     // The upstream is restarted or the next source is used
+)
+
+// slateTexts : Text of the slates that are generated with FFmpeg
+var slateTexts = map[string]string{
+	slateTunerLimit:      "All tuners are in use",
+	slateChannelOffline:  "Channel is offline",
+	slateUpstreamFailure: "Channel is not available, reconnecting...",
+	slateReconnecting:    "Reconnecting...",
+}
+
+// slateNames : All slates in the order of the web interface and the API
+var slateNames = []string{slateTunerLimit, slateChannelOffline, slateUpstreamFailure, slateReconnecting}
+
+// Interval in which the slate data is sent
+const slateInterval = 100 * time.Millisecond
+
+// Interval in which the sources of a failed stream are tried again while the slate is shown
+const slateRetryInterval = 30 * time.Second
+
+// Interval in which a tuner is requested again while the tuner limit slate is shown
+const slateTunerRetryInterval = 5 * time.Second
+
+// Maximum duration of the tuner limit slate, the client is disconnected afterwards
+const slateTunerLimitTimeout = 30 * time.Second
+
+// Duration of the slates that are generated with FFmpeg
+const slateGenerateDuration = 5
+
+// Bitrate that is assumed for slates without timestamps (bit/s)
+const slateDefaultBitrate = 4 * 1000 * 1000
+
+// slate : MPEG-TS video of a slate
+type slate struct {
+	Name     string
+	Data     []byte
+	Duration time.Duration
+}
+
+// SlateInfo : Slate for the API
+type SlateInfo struct {
+	Name     string  `json:"name"`
+	Custom   bool    `json:"custom"` // Uploaded or generated, otherwise the built-in video or none
+	Size     int     `json:"size"`
+	Duration float64 `json:"duration"`
+}
+
+// slatePlayer : Slate that is written into the buffer of a stream
+type slatePlayer struct {
+	name   string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// getSlate : Slate from the slates folder. The tuner limit uses the built-in video if no slate has been uploaded, nil if the slate is not available.
+func getSlate(name string) (s *slate) {
+
+	var data []byte
+
+	if content, err := os.ReadFile(getSlateFile(name)); err == nil {
+		data = content
+	} else if name == slateTunerLimit {
+
+		if value, ok := webUI["html/video/stream-limit.ts"]; ok {
+			data = []byte(GetHTMLString(value.(string)))
+		}
+
+	}
+
+	// Complete MPEG-TS packets only, so that the slate can be looped
+	var i = tsSync(data)
+	if i < 0 {
+		return nil
+	}
+
+	data = data[i:]
+	data = data[:len(data)-len(data)%tsPacketSize]
+
+	s = &slate{Name: name, Data: data, Duration: getTSDuration(data)}
+
+	if s.Duration <= 0 {
+		s.Duration = time.Duration(len(data)) * 8 * time.Second / slateDefaultBitrate
+	}
+
+	return
+}
+
+// getSlateFile : File of a slate in the slates folder
+func getSlateFile(name string) string {
+	return System.Folder.Slates + name + ".ts"
+}
+
+// getSlateTextFile : Text of a generated slate, uploaded slates have no text file
+func getSlateTextFile(name string) string {
+	return System.Folder.Slates + name + ".txt"
+}
+
+// getSlates : Information about all slates
+func getSlates() (slates []SlateInfo) {
+
+	for _, name := range slateNames {
+
+		var info = SlateInfo{Name: name}
+
+		if _, err := os.Stat(getSlateFile(name)); err == nil {
+			info.Custom = true
+		}
+
+		if s := getSlate(name); s != nil {
+			info.Size = len(s.Data)
+			info.Duration = s.Duration.Seconds()
+		}
+
+		slates = append(slates, info)
+
+	}
+
+	return
+}
+
+// checkSlateName : Only the known slates can be changed
+func checkSlateName(name string) (err error) {
+
+	if indexOfString(name, slateNames) == -1 {
+		err = fmt.Errorf("Unknown slate: %s (%s)", name, strings.Join(slateNames, ", "))
+	}
+
+	return
+}
+
+// uploadSlate : Saves an MPEG-TS video (Base64) as slate
+func uploadSlate(name, input string) (err error) {
+
+	if err = checkSlateName(name); err != nil {
+		return
+	}
+
+	data, err := b64.StdEncoding.DecodeString(input[strings.IndexByte(input, ',')+1:])
+	if err != nil {
+		return
+	}
+
+	if tsSync(data) < 0 {
+		err = errors.New("Slate is not an MPEG-TS video")
+		return
+	}
+
+	err = writeByteToFile(getSlateFile(name), data)
+	if err == nil {
+		os.Remove(getSlateTextFile(name))
+		showInfo(fmt.Sprintf("Slate:%s was uploaded", name))
+	}
+
+	return
+}
+
+// deleteSlate : Removes an uploaded or generated slate
+func deleteSlate(name string) (err error) {
+
+	if err = checkSlateName(name); err != nil {
+		return
+	}
+
+	err = os.Remove(getSlateFile(name))
+	os.Remove(getSlateTextFile(name))
+
+	return
+}
+
+// generateSlate : Creates a slate with FFmpeg (transcode.path), a black video with the text. Without the drawtext filter of FFmpeg, the video has no text.
+// The yt-dlp wrapper of the buffer can not create videos. A slate that was already created with the same text is kept.
+func generateSlate(name, text string) (err error) {
+
+	if err = checkSlateName(name); err != nil {
+		return
+	}
+
+	if len(text) == 0 {
+		text = slateTexts[name]
+	}
+
+	if content, e := os.ReadFile(getSlateTextFile(name)); e == nil && string(content) == text && checkFile(getSlateFile(name)) == nil {
+		return
+	}
+
+	if err = checkFile(Settings.TranscodePath); err != nil {
+		return
+	}
+
+	var replacer = strings.NewReplacer(`\`, `\\`, `'`, "", `:`, `\:`, `%`, `\%`)
+	var filter = fmt.Sprintf("drawtext=text='%s':fontcolor=white:fontsize=56:x=(w-text_w)/2:y=(h-text_h)/2", replacer.Replace(text))
+
+	var args = func(filter string) (args []string) {
+
+		args = []string{"-hide_banner", "-loglevel", "error", "-y",
+			"-f", "lavfi", "-i", "color=c=black:s=1280x720:r=25",
+			"-f", "lavfi", "-i", "anullsrc=r=48000:cl=stereo",
+			"-t", fmt.Sprintf("%d", slateGenerateDuration)}
+
+		if len(filter) > 0 {
+			args = append(args, "-vf", filter)
+		}
+
+		return append(args, "-c:v", "libx264", "-preset", "veryfast", "-pix_fmt", "yuv420p", "-g", "25", "-c:a", "aac", "-b:a", "64k", "-f", "mpegts", getSlateFile(name))
+	}
+
+	output, err := exec.Command(Settings.TranscodePath, args(filter)...).CombinedOutput()
+	if err != nil {
+
+		showDebug(fmt.Sprintf("Slate:FFmpeg could not create the text (%s), the slate is created without text", strings.TrimSpace(string(output))), 1)
+
+		output, err = exec.Command(Settings.TranscodePath, args("")...).CombinedOutput()
+		if err != nil {
+			err = fmt.Errorf("%s (%s)", err.Error(), strings.TrimSpace(string(output)))
+			return
+		}
+
+	}
+
+	if err = writeByteToFile(getSlateTextFile(name), []byte(text)); err != nil {
+		return
+	}
+
+	showInfo(fmt.Sprintf("Slate:%s was created (%s)", name, text))
+
+	return
+}
+
+// initSlates : Creates the missing slates with FFmpeg (buffer.slates). The tuner limit has a built-in video. Existing slates are not created again.
+func initSlates() {
+
+	if !Settings.BufferSlates || checkFile(Settings.TranscodePath) != nil {
+		return
+	}
+
+	for _, name := range slateNames {
+
+		if name == slateTunerLimit {
+			continue
+		}
+
+		if _, err := os.Stat(getSlateFile(name)); err == nil {
+			continue
+		}
+
+		if err := generateSlate(name, ""); err != nil {
+			ShowError(err, 4009)
+		}
+
+	}
+
+}
+
+// Play : Sends the slate in a loop in real time, until the context is cancelled or the writer fails
+func (s *slate) Play(ctx context.Context, w io.Writer) (err error) {
+
+	// Data per interval, complete MPEG-TS packets
+	var chunk = int(float64(len(s.Data)) / s.Duration.Seconds() * slateInterval.Seconds())
+	chunk -= chunk % tsPacketSize
+
+	if chunk < tsPacketSize {
+		chunk = tsPacketSize
+	}
+
+	var ticker = time.NewTicker(slateInterval)
+	defer ticker.Stop()
+
+	var offset = 0
+
+	for {
+
+		var end = offset + chunk
+		if end > len(s.Data) {
+			end = len(s.Data)
+		}
+
+		if _, err = w.Write(s.Data[offset:end]); err != nil {
+			return
+		}
+
+		offset = end
+		if offset >= len(s.Data) {
+			offset = 0
+		}
+
+		select {
+
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+
+		}
+
+	}
+
+}
+
+// PlaySlate : Writes the slate into the buffer until the next data of a source arrives. A slate that is already shown continues.
+func (t *tsWriter) PlaySlate(name string) {
+
+	if !Settings.BufferSlates {
+		return
+	}
+
+	if t.slate != nil && t.slate.name == name {
+		return
+	}
+
+	t.StopSlate()
+
+	var s = getSlate(name)
+	if s == nil {
+		return
+	}
+
+	showInfo(fmt.Sprintf("Slate:%s", name))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var player = &slatePlayer{name: name, cancel: cancel, done: make(chan struct{})}
+
+	t.buffer.Discontinuity()
+
+	go func() {
+		defer close(player.done)
+		s.Play(ctx, newTSWriter(t.buffer))
+	}()
+
+	t.slate = player
+
+}
+
+// StopSlate : Stops the slate, the following data starts in a new segment
+func (t *tsWriter) StopSlate() {
+
+	if t.slate == nil {
+		return
+	}
+
+	t.slate.cancel()
+	<-t.slate.done
+	t.slate = nil
+
+	t.buffer.Discontinuity()
+	t.Reset()
+
+}
+
+// getTSDuration : Duration of MPEG-TS data, from the timestamps (PTS) of the first stream with timestamps.
+// The duration of the last frame is the average duration of the frames before, reordered frames (B-frames) are covered by the lowest and highest timestamp.
+func getTSDuration(data []byte) (duration time.Duration) {
+
+	var pid = -1
+	var first, last int64
+	var frames int64
+
+	for i := tsSync(data); i >= 0 && i+tsPacketSize <= len(data); i += tsPacketSize {
+
+		var packet = data[i : i+tsPacketSize]
+
+		// Start of a PES packet
+		if packet[0] != tsSyncByte || packet[1]&0x40 == 0 {
+			continue
+		}
+
+		var packetPID = int(packet[1]&0x1f)<<8 | int(packet[2])
+		if pid >= 0 && packetPID != pid {
+			continue
+		}
+
+		var offset = 4
+		if packet[3]&0x20 != 0 {
+			offset += 1 + int(packet[4])
+		}
+
+		if offset+14 > tsPacketSize {
+			continue
+		}
+
+		var pes = packet[offset:]
+		if pes[0] != 0 || pes[1] != 0 || pes[2] != 1 || pes[7]&0x80 == 0 {
+			continue
+		}
+
+		var pts = int64(pes[9]&0x0e)<<29 | int64(pes[10])<<22 | int64(pes[11]&0xfe)<<14 | int64(pes[12])<<7 | int64(pes[13])>>1
+
+		if pid < 0 {
+			pid = packetPID
+			first, last = pts, pts
+		}
+
+		first = min(first, pts)
+		last = max(last, pts)
+		frames++
+
+	}
+
+	// A wrap of the 33 bit timestamps is not measured
+	if frames > 1 && last > first && last-first < 1<<32 {
+		duration = time.Duration((last-first)*frames/(frames-1)) * time.Second / 90000
+	}
+
+	return
+}
@@ -68,6 +68,8 @@ type SystemStruct struct {
                 Cache        string
                 Config       string
                 Data         string
+                Recordings   string
+                Slates       string
                 ImagesCache  string
                 ImagesUpload string
                 Temp         string
@@ -198,9 +200,10 @@ type XEPGChannelStruct struct {
         XMapping           string        `json:"x-mapping"`
         XmltvFile          string        `json:"x-xmltv-file"`
         XPpvExtra          string        `json:"x-ppv-extra"`
-        XBackupChannel1    string        `json:"x-backup-channel-1"`
-        XBackupChannel2    string        `json:"x-backup-channel-2"`
-        XBackupChannel3    string        `json:"x-backup-channel-3"`
+        XBackupChannels    []BackupSource `json:"x-backup-channels"`
+        XBufferProfile     string        `json:"x-buffer-profile"`
+        XTimeShift         string        `json:"x-timeshift"`
+        XKeepWarm          bool          `json:"x-keep-warm"`
         XHideChannel       bool          `json:"x-hide-channel"`
         XName              string        `json:"x-name"`
         XUpdateChannelIcon bool          `json:"x-update-channel-icon"`
@@ -208,12 +211,16 @@ type XEPGChannelStruct struct {
         XDescription       string        `json:"x-description"`
         Live               bool          `json:"live"`
         IsBackupChannel    bool          `json:"is_backup_channel"`
-        BackupChannel1     *BackupStream `json:"backup_channel_1"`
-        BackupChannel2     *BackupStream `json:"backup_channel_2"`
-        BackupChannel3     *BackupStream `json:"backup_channel_3"`
+        BackupChannels     []BackupStream `json:"backup_channels"`
         ChannelUniqueID    string        `json:"channelUniqueID"`
 }
 
+// BackupSource : Backup channel in the mapping, used in the order of the list
+type BackupSource struct {
+        PlaylistID string `json:"playlistID"`
+        Channel    string `json:"channel"` // _uuid.value of the channel, tvg-name if the provider has no unique IDs
+}
+
 // M3UChannelStructXEPG : M3U Structure for XEPG
 type M3UChannelStructXEPG struct {
         FileM3UID       string `json:"_file.m3u.id,required"`
@@ -260,9 +267,9 @@ type StreamInfo struct {
         Name           string        `json:"name,required"`
         PlaylistID     string        `json:"playlistID,required"`
         URL            string        `json:"url,required"`
-        BackupChannel1 *BackupStream `json:"backup_channel_1,required"`
-        BackupChannel2 *BackupStream `json:"backup_channel_2,required"`
-        BackupChannel3 *BackupStream `json:"backup_channel_3,required"`
+        BackupChannels []BackupStream `json:"backupChannels"`
+        BufferProfile  string        `json:"bufferProfile"`
+        TimeShift      int           `json:"timeShift"`
         URLid          string        `json:"urlID,required"`
 }
 
@@ -287,8 +294,17 @@ type SettingsStruct struct {
         BackupPath        string   `json:"backup.path"`
         Branch            string   `json:"git.branch,omitempty"`
         Buffer            string   `json:"buffer"`
+        BufferProfiles    map[string]BufferProfile `json:"buffer.profiles"`
+        BufferProfileGroups map[string]string      `json:"buffer.profile.groups"`
         BufferSize        int      `json:"buffer.size.kb"`
         BufferTimeout     float64  `json:"buffer.timeout"`
+        BufferStreamQuota int      `json:"buffer.quota.stream.mb"`
+        BufferTotalQuota  int      `json:"buffer.quota.total.mb"`
+        BufferTimeShift   int      `json:"buffer.timeshift.minutes"`
+        BufferFailback    int      `json:"buffer.failback.minutes"`
+        BufferLinger      int      `json:"buffer.linger.sec"`
+        BufferSlates      bool     `json:"buffer.slates"`
+        StreamHeadProbe   bool     `json:"stream.head.probe"`
         CacheImages       bool     `json:"cache.images"`
         EpgSource         string   `json:"epgSource"`
         FFmpegOptions     string   `json:"ffmpeg.options"`
@@ -311,13 +327,26 @@ type SettingsStruct struct {
         MappingFirstChannel       float64               `json:"mapping.first.channel"`
         Port                      string                `json:"port"`
         SSDP                      bool                  `json:"ssdp"`
+        StreamSigning             bool                  `json:"stream.signing"`
+        StreamSigningSecret       string                `json:"stream.signing.secret"`
+        StreamSigningExpiry       int                   `json:"stream.signing.expiry.hours"`
+        StreamSigningGrace        int                   `json:"stream.signing.grace.hours"`
         TempPath                  string                `json:"temp.path"`
         Tuner                     int                   `json:"tuner"`
+        TunerPriorities           []TunerPriority       `json:"tuner.priorities"`
+        TunerQueue                int                   `json:"tuner.queue.sec"`
+        TranscodePath             string                `json:"transcode.path"`
+        TranscodeProfiles         map[string]BufferProfile `json:"transcode.profiles"`
+        RecordingsPath            string                `json:"recordings.path"`
+        RecordingPaddingStart     int                   `json:"recording.padding.start.minutes"`
+        RecordingPaddingEnd       int                   `json:"recording.padding.end.minutes"`
+        RecordingRules            []RecordingRule       `json:"recording.rules"`
         Update                    []string              `json:"update"`
         UpdateURL                 string                `json:"update.url,omitempty"`
         UserAgent                 string                `json:"user.agent"`
         UUID                      string                `json:"uuid"`
         UDPxy                     string                `json:"udpxy"`
+        UDPInterface              string                `json:"udp.interface"`
         Version                   string                `json:"version"`
         XepgReplaceMissingImages  bool                  `json:"xepg.replace.missing.images"`
         XepgReplaceChannelTitle   bool                  `json:"xepg.replace.channel.title"`
@@ -458,8 +487,17 @@ func loadSettings() (settings SettingsStruct, err error) {
 	defaults["backup.keep"] = 10
 	defaults["backup.path"] = System.Folder.Backup
 	defaults["buffer"] = "ffmpeg"
+	defaults["buffer.profiles"] = make(map[string]interface{})
+	defaults["buffer.profile.groups"] = make(map[string]interface{})
 	defaults["buffer.size.kb"] = 1024
 	defaults["buffer.timeout"] = 500
+	defaults["buffer.quota.stream.mb"] = 0
+	defaults["buffer.quota.total.mb"] = 0
+	defaults["buffer.timeshift.minutes"] = 0
+	defaults["buffer.failback.minutes"] = 5
+	defaults["buffer.linger.sec"] = 0
+	defaults["buffer.slates"] = false
+	defaults["stream.head.probe"] = false
 	defaults["cache.images"] = false
 	defaults["epgSource"] = "XEPG"
 	defaults["ffmpeg.options"] = System.FFmpeg.DefaultOptions
@@ -475,6 +513,10 @@ func loadSettings() (settings SettingsStruct, err error) {
 	defaults["m3u8.adaptive.bandwidth.mbps"] = 10
 	defaults["port"] = "34400"
 	defaults["ssdp"] = true
+	defaults["stream.signing"] = false
+	defaults["stream.signing.secret"] = randomString(32)
+	defaults["stream.signing.expiry.hours"] = defaultStreamSigningExpiry
+	defaults["stream.signing.grace.hours"] = 72
 	defaults["storeBufferInRAM"] = true
 	defaults["forceHttps"] = false
 	defaults["httpsPort"] = 443
@@ -484,10 +526,19 @@ func loadSettings() (settings SettingsStruct, err error) {
 	defaults["epgCategories"] = "Kids:kids|News:news|Movie:movie|Series:series|Sports:sports"
 	defaults["epgCategoriesColors"] = "kids:mediumpurple|news:tomato|movie:royalblue|series:gold|sports:yellowgreen"
 	defaults["tuner"] = 1
+	defaults["tuner.priorities"] = make([]interface{}, 0)
+	defaults["tuner.queue.sec"] = 0
+	defaults["transcode.path"] = defaultTranscodePath
+	defaults["transcode.profiles"] = make(map[string]interface{})
+	defaults["recordings.path"] = System.Folder.Recordings
+	defaults["recording.padding.start.minutes"] = 1
+	defaults["recording.padding.end.minutes"] = 5
+	defaults["recording.rules"] = make([]interface{}, 0)
 	defaults["update"] = []string{"0000"}
 	defaults["user.agent"] = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/136.0.0.0 Safari/537.36"
 	defaults["uuid"] = createUUID()
 	defaults["udpxy"] = ""
+	defaults["udp.interface"] = ""
 	defaults["version"] = System.DBVersion
 	if isRunningInContainer() {
 		defaults["ThreadfinAutoUpdate"] = false
@@ -519,8 +570,9 @@ func loadSettings() (settings SettingsStruct, err error) {
 		settings.FFmpegPath = "/home/threadfin/bin/wrapper"
 	}
 
-	// Initialze virutal filesystem for the Buffer
-	initBufferVFS()
+	if len(settings.TranscodePath) == 0 {
+		settings.TranscodePath = defaultTranscodePath
+	}
 
 	settings.Version = System.DBVersion
 
@@ -624,7 +676,8 @@ func setDeviceID() {
 }
 
 // Convert provider streaming URL to Threadfin streaming URL
-func createStreamingURL(streamingType, playlistID, channelNumber, channelName, url string, backup_channel_1 *BackupStream, backup_channel_2 *BackupStream, backup_channel_3 *BackupStream) (streamingURL string, err error) {
+// The URL is signed if signed streaming URLs are enabled, the user is optional
+func createStreamingURL(streamingType, playlistID, channelNumber, channelName, url string, backupChannels []BackupStream, bufferProfile string, timeShift int, user string) (streamingURL string, err error) {
 
 	var streamInfo StreamInfo
 	var serverProtocol string
@@ -640,9 +693,9 @@ func createStreamingURL(streamingType, playlistID, channelNumber, channelName, u
 
 	} else {
 		streamInfo.URL = url
-		streamInfo.BackupChannel1 = backup_channel_1
-		streamInfo.BackupChannel2 = backup_channel_2
-		streamInfo.BackupChannel3 = backup_channel_3
+		streamInfo.BackupChannels = backupChannels
+		streamInfo.BufferProfile = bufferProfile
+		streamInfo.TimeShift = timeShift
 		streamInfo.Name = channelName
 		streamInfo.PlaylistID = playlistID
 		streamInfo.ChannelNumber = channelNumber
@@ -669,7 +722,7 @@ func createStreamingURL(streamingType, playlistID, channelNumber, channelName, u
 		}
 	}
 
-	streamingURL = fmt.Sprintf("%s://%s/stream/%s", serverProtocol, System.Domain, streamInfo.URLid)
+	streamingURL = signStreamingURL(fmt.Sprintf("%s://%s/stream/%s", serverProtocol, System.Domain, streamInfo.URLid), streamInfo.URLid, user)
 	return
 }
 
@@ -691,10 +744,6 @@ func getStreamInfo(urlID string) (streamInfo StreamInfo, err error) {
 
 	if s, ok := Data.Cache.StreamingURLS[urlID]; ok {
 		s.URL = strings.Trim(s.URL, "\r\n")
-		s.BackupChannel1 = s.BackupChannel1
-		s.BackupChannel2 = s.BackupChannel2
-		s.BackupChannel3 = s.BackupChannel3
-
 		streamInfo = s
 	} else {
 		err = errors.New("streaming error")
@@ -60,8 +60,7 @@ func checkVFSFolder(path string, vfs avfs.VFS) (err error) {
 
 		// If we are on Windows and the cache location path is NOT on C:\ we need to create the volume it is located on
 		// Failure to do so here will result in a panic error and the stream not playing
-		vm := vfs.(avfs.VolumeManager)
-		if vfs.OSType() == avfs.OsWindows && avfs.VolumeName(vfs, path) != "C:" {
+		if vm, ok := vfs.(avfs.VolumeManager); ok && vfs.OSType() == avfs.OsWindows && avfs.VolumeName(vfs, path) != "C:" {
 			vm.VolumeAdd(path)
 		}
 
@@ -0,0 +1,307 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// defaultTranscodePath : FFmpeg of the container, default of the setting transcode.path. The yt-dlp wrapper only passes the input options to FFmpeg and can not transcode.
+const defaultTranscodePath = "/usr/lib/jellyfin-ffmpeg/ffmpeg"
+
+// bufferInput : Reads the buffer of a stream as continuous data, input of the transcoder
+type bufferInput struct {
+	reader  *bufferReader
+	pending []byte
+}
+
+// defaultTranscodeProfiles : Transcoding profiles of the HDHomeRun EXTEND (?transcode=), the settings (transcode.profiles) can override them or add new ones
+var defaultTranscodeProfiles = map[string]string{
+	"heavy":       transcodeArgs("", "-crf 23"),
+	"mobile":      transcodeArgs("scale=-2:720,fps=30", "-b:v 2000k -maxrate 2000k -bufsize 4000k"),
+	"internet720": transcodeArgs("scale=-2:720", "-b:v 2000k -maxrate 2000k -bufsize 4000k"),
+	"internet540": transcodeArgs("scale=-2:540", "-b:v 1200k -maxrate 1200k -bufsize 2400k"),
+	"internet480": transcodeArgs("scale=-2:480", "-b:v 800k -maxrate 800k -bufsize 1600k"),
+	"internet360": transcodeArgs("scale=-2:360", "-b:v 500k -maxrate 500k -bufsize 1000k"),
+	"internet240": transcodeArgs("scale=-2:240", "-b:v 250k -maxrate 250k -bufsize 500k"),
+}
+
+// transcodeArgs : FFmpeg arguments for H.264 / AAC in MPEG-TS with a video filter and the rate control of the profile
+func transcodeArgs(filter, rate string) (args string) {
+
+	args = "-hide_banner -loglevel error -i [URL] -map 0:v:0 -map 0:a:0? -c:v libx264 -preset veryfast -pix_fmt yuv420p "
+
+	if len(filter) > 0 {
+		args += "-vf " + filter + " "
+	}
+
+	args += rate + " -c:a aac -b:a 128k -ac 2 -f mpegts pipe:1"
+
+	return
+}
+
+// getTranscodeProfile : Settings of a transcoding profile, false if the profile does not exist. The names are not case-sensitive.
+func getTranscodeProfile(name string) (profile BufferProfile, ok bool) {
+
+	if len(name) == 0 {
+		return
+	}
+
+	name = strings.ToLower(name)
+
+	for key, p := range Settings.TranscodeProfiles {
+
+		if strings.ToLower(key) == name {
+			profile, ok = p, true
+			break
+		}
+
+	}
+
+	if !ok {
+
+		var args string
+		if args, ok = defaultTranscodeProfiles[name]; !ok {
+			return
+		}
+
+		profile.Args = args
+
+	}
+
+	if len(profile.Path) == 0 {
+		profile.Path = Settings.TranscodePath
+	}
+
+	if len(strings.TrimSpace(profile.Args)) == 0 {
+		profile.Args = System.FFmpeg.DefaultOptions
+	}
+
+	if profile.StartupTimeout <= 0 {
+		profile.StartupTimeout = defaultStartupTimeout
+	}
+
+	if profile.StallTimeout <= 0 {
+		profile.StallTimeout = defaultStallTimeout
+	}
+
+	return
+}
+
+// getTranscodeProfileNames : Transcoding profiles whose FFmpeg is available (lower case, as the clients request them)
+func getTranscodeProfileNames() (names []string) {
+
+	var profiles = make(map[string]bool)
+
+	for name := range defaultTranscodeProfiles {
+		profiles[name] = true
+	}
+
+	for name := range Settings.TranscodeProfiles {
+		profiles[strings.ToLower(name)] = true
+	}
+
+	for name := range profiles {
+
+		if profile, ok := getTranscodeProfile(name); ok && checkFile(profile.Path) == nil {
+			names = append(names, name)
+		}
+
+	}
+
+	sort.Strings(names)
+
+	return
+}
+
+// getTranscode : Transcoding profile requested by the client (?transcode=), empty for the original stream
+func getTranscode(r *http.Request) (name string) {
+
+	name = strings.ToLower(r.URL.Query().Get("transcode"))
+
+	switch name {
+
+	case "", "none":
+		return ""
+
+	}
+
+	profile, ok := getTranscodeProfile(name)
+	if !ok {
+		showInfo(fmt.Sprintf("Transcode:Unknown profile: %s, the original stream is used", name))
+		return ""
+	}
+
+	if err := checkFile(profile.Path); err != nil {
+		showInfo(fmt.Sprintf("Transcode:FFmpeg for the profile %s was not found (%s), the original stream is used", name, profile.Path))
+		return ""
+	}
+
+	return
+}
+
+// getStreamMD5 : Identifies a stream in the buffer. Clients that request the same channel with the same transcoding profile share one stream.
+func getStreamMD5(streamingURL, transcode string) string {
+
+	if len(transcode) == 0 {
+		return getMD5(streamingURL)
+	}
+
+	return getMD5(streamingURL + "#transcode=" + transcode)
+}
+
+// connectTranscodeStream : Registers the first client of a transcoded stream. The transcoder is a client of the original stream and reads its buffer,
+// so the original stream and all of its transcoded streams share one upstream and one tuner.
+func connectTranscodeStream(playlistID, streamingURL, transcode string, backupChannels []BackupStream, channelName, bufferProfile string, timeShift int, r *http.Request) (connectedPlaylistID string, streamID int, ok bool) {
+
+	// The original stream is started or joined like for a client without transcoding, with the priority of the client
+	var native = r.Clone(r.Context())
+	var query = native.URL.Query()
+	query.Del("transcode")
+	native.URL.RawQuery = query.Encode()
+
+	nativePlaylistID, nativeStreamID, ok := connectStream(playlistID, streamingURL, backupChannels, channelName, bufferProfile, timeShift, native)
+	if !ok {
+		return
+	}
+
+	Lock.Lock()
+
+	var playlist *Playlist
+	if p, found := BufferInformation.Load(playlistID); found {
+		playlist = p.(*Playlist)
+	} else {
+		playlist = newBufferPlaylist(playlistID)
+	}
+
+	// Another client has started the same transcoding in the meantime, the client joins it
+	for _, stream := range playlist.Streams {
+
+		if stream.URL == streamingURL && stream.Transcode == transcode && stream.buffer != nil && !stream.buffer.Closed() {
+
+			Lock.Unlock()
+			killClientConnection(nativeStreamID, nativePlaylistID)
+
+			return connectStream(playlistID, streamingURL, backupChannels, channelName, bufferProfile, timeShift, r)
+		}
+
+	}
+
+	streamID = createStreamID(playlist.Streams, getClientIP(r), r.UserAgent())
+
+	var stream = newBufferStream(playlist, streamingURL, transcode, nil, channelName, bufferProfile, timeShift)
+	stream.nativePlaylistID = nativePlaylistID
+	stream.nativeStreamID = nativeStreamID
+
+	playlist.Streams[streamID] = stream
+	playlist.Clients[streamID] = ThisClient{Connection: 1}
+	BufferInformation.Store(playlistID, playlist)
+
+	showInfo(fmt.Sprintf("Transcode:Channel: %s - Profile: %s, the original stream is used as input", channelName, transcode))
+
+	Lock.Unlock()
+
+	go startBuffer(streamID, playlistID)
+
+	return playlistID, streamID, true
+}
+
+// transcodeBuffer : Writes the output of the transcoder into the buffer of the transcoded stream, FFmpeg reads the buffer of the original stream.
+// The original stream takes care of failover and slates. If it stops or the transcoder fails, the transcoded stream is closed.
+// The transcoded stream remains a client of the original stream until it is removed (deleteStream).
+func transcodeBuffer(streamID int, stream ThisStream, writer *tsWriter) {
+
+	var buffer = writer.buffer
+	var native *streamBuffer
+
+	Lock.RLock()
+	if p, ok := BufferInformation.Load(stream.nativePlaylistID); ok {
+
+		if s, ok := p.(*Playlist).Streams[stream.nativeStreamID]; ok {
+			native = s.buffer
+		}
+
+	}
+	Lock.RUnlock()
+
+	if native == nil {
+		buffer.Close(errors.New("Transcode: The original stream is not running"))
+		return
+	}
+
+	// The input of the transcoder stops with the transcoded stream
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+
+		select {
+
+		case <-buffer.Done():
+			cancel()
+
+		case <-ctx.Done():
+
+		}
+
+	}()
+
+	if err := native.WaitReady(ctx); err != nil {
+		buffer.Close(err)
+		return
+	}
+
+	var profile, _ = getTranscodeProfile(stream.Transcode)
+	var source = bufferSource{Name: "Primary", URL: stream.URL, Playlist: Playlist{PlaylistID: stream.PlaylistID, Buffer: "ffmpeg"}}
+
+	var reader = native.NewReader(ctx)
+	defer reader.Close()
+
+	var backend = newFFmpegBackend(source.Playlist, profile, "pipe:0")
+	backend.input = &bufferInput{reader: reader}
+
+	if err := backend.Start(); err != nil {
+		backend.Stop()
+		ShowError(err, 1204)
+		buffer.Close(err)
+		return
+	}
+
+	updateStream(stream.PlaylistID, streamID, func(s *ThisStream) {
+		s.Source = "Transcode " + stream.Transcode
+		s.SourceURL = stream.URL
+	})
+
+	// The transcoded stream has no backup channels, the failback is never scheduled
+	var failback = newStreamFailback(source, profile, stream)
+	defer failback.Stop()
+
+	_, err := pumpBuffer(streamID, stream, source, backend, writer, profile, failback)
+	backend.Stop()
+
+	if err != nil {
+		ShowError(err, 1204)
+	}
+
+	buffer.Close(err)
+
+}
+
+func (i *bufferInput) Read(p []byte) (n int, err error) {
+
+	if len(i.pending) == 0 {
+
+		if i.pending, err = i.reader.Read(); err != nil {
+			return
+		}
+
+	}
+
+	n = copy(p, i.pending)
+	i.pending = i.pending[n:]
+
+	return
+}
@@ -0,0 +1,408 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TunerPriority : Priority of the streams of a user or a client IP range (tuner.priorities)
+type TunerPriority struct {
+	Match    string `json:"match"` // User name, IP address or CIDR range
+	Priority int    `json:"priority"`
+}
+
+// tunerSlot : Tuner that is used by a stream
+type tunerSlot struct {
+	PlaylistID  string
+	Key         string // Playlist ID + MD5 of the streaming URL
+	Stream      string // Key of the stream that uses the tuner, a backup source of another provider uses the tuner for the stream
+	ChannelName string
+	Priority    int
+	Started     time.Time
+}
+
+// tunerWaiter : Request that waits for a free tuner (tuner.queue.sec)
+type tunerWaiter struct {
+	PlaylistID  string
+	Key         string
+	ChannelName string
+	Priority    int
+	granted     chan struct{} // Closed when the tuner has been assigned to the waiter
+}
+
+// tunerManager : Assigns the tuners of all providers. Every provider has its own limit, all streams together are limited by the tuner setting.
+// Requests that wait for a tuner receive the free tuners in the order of their arrival, before new requests.
+type tunerManager struct {
+	slots   map[string]*tunerSlot
+	waiters []*tunerWaiter
+	mutex   sync.Mutex
+}
+
+// Maximum number of requests that wait for a tuner, further requests receive the tuner limit immediately
+const tunerQueueLimit = 32
+
+// tuners : Tuners of all active streams
+var tuners = &tunerManager{slots: make(map[string]*tunerSlot)}
+
+// errTunerPreempted : The tuner of the stream was assigned to a stream with a higher priority
+var errTunerPreempted = errors.New("Tuner was assigned to a stream with a higher priority")
+
+// Acquire : Assigns a tuner to the stream, a stream that is already running keeps its tuner.
+// If no tuner is available, the stream with the lowest priority is stopped, as long as its priority is lower than the priority of the request.
+func (m *tunerManager) Acquire(playlistID, key, channelName string, priority int) (ok bool) {
+	return m.acquire(&tunerSlot{PlaylistID: playlistID, Key: key, Stream: key, ChannelName: channelName, Priority: priority})
+}
+
+// AcquireSource : Assigns a tuner of another provider to a backup source of the stream, with the priority of the stream.
+// If the tuner is assigned to a stream with a higher priority, the stream is stopped. False if the stream has no tuner anymore.
+func (m *tunerManager) AcquireSource(playlistID, key, streamKey, channelName string) (ok bool) {
+
+	m.mutex.Lock()
+	stream, ok := m.slots[streamKey]
+	var priority int
+	if ok {
+		priority = stream.Priority
+	}
+	m.mutex.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	return m.acquire(&tunerSlot{PlaylistID: playlistID, Key: key, Stream: streamKey, ChannelName: channelName, Priority: priority})
+}
+
+// acquire : Assigns the tuner of the slot, see Acquire
+func (m *tunerManager) acquire(request *tunerSlot) (ok bool) {
+
+	var preempted *tunerSlot
+	var playlistID, priority = request.PlaylistID, request.Priority
+
+	m.mutex.Lock()
+
+	// Free tuners are assigned to the waiting requests first
+	m.grant()
+
+	if _, ok := m.slots[request.Key]; ok {
+
+		// The priority of a stream is the highest priority of its clients, its backup sources use the same priority
+		for _, slot := range m.slots {
+			if slot.Stream == request.Stream && priority > slot.Priority {
+				slot.Priority = priority
+			}
+		}
+
+		m.mutex.Unlock()
+		return true
+	}
+
+	var providerLimit = getTuner(playlistID, getPlaylistType(playlistID))
+	var totalLimit = getTunerCount()
+	var provider, total = m.count(playlistID)
+
+	if provider >= providerLimit || total >= totalLimit {
+
+		// If the provider has no free tuner, only one of its own streams can be stopped
+		var providerFull = provider >= providerLimit
+
+		for _, slot := range m.slots {
+
+			if providerFull && slot.PlaylistID != playlistID {
+				continue
+			}
+
+			if slot.Priority >= priority {
+				continue
+			}
+
+			if preempted == nil || slot.Priority < preempted.Priority || (slot.Priority == preempted.Priority && slot.Started.After(preempted.Started)) {
+				preempted = slot
+			}
+
+		}
+
+		if preempted == nil {
+			m.mutex.Unlock()
+			return false
+		}
+
+		delete(m.slots, preempted.Key)
+
+	}
+
+	request.Started = time.Now()
+	m.slots[request.Key] = request
+
+	m.mutex.Unlock()
+
+	if preempted != nil {
+		showInfo(fmt.Sprintf("Tuner:Channel: %s (Priority: %d) is stopped for %s (Priority: %d)", preempted.ChannelName, preempted.Priority, request.ChannelName, priority))
+		preemptStream(preempted)
+	}
+
+	return true
+}
+
+// Available : A stream would receive a tuner (running stream, free tuner or a stream with a lower priority), no tuner is assigned
+func (m *tunerManager) Available(playlistID, key string, priority int) bool {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.slots[key]; ok {
+		return true
+	}
+
+	var providerLimit = getTuner(playlistID, getPlaylistType(playlistID))
+	var provider, total = m.count(playlistID)
+
+	if provider < providerLimit && total < getTunerCount() {
+		return true
+	}
+
+	for _, slot := range m.slots {
+
+		if provider >= providerLimit && slot.PlaylistID != playlistID {
+			continue
+		}
+
+		if slot.Priority < priority {
+			return true
+		}
+
+	}
+
+	return false
+}
+
+// Release : The stream no longer needs its tuner, the tuner is assigned to the next waiting request
+func (m *tunerManager) Release(key string) {
+
+	m.mutex.Lock()
+	delete(m.slots, key)
+	m.grant()
+	m.mutex.Unlock()
+
+}
+
+// Holds : The tuner is assigned
+func (m *tunerManager) Holds(key string) bool {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	_, ok := m.slots[key]
+
+	return ok
+}
+
+// Standby : The stream keeps its tuner without clients (keep warm). Every request that needs the tuner takes it over.
+func (m *tunerManager) Standby(key string) {
+
+	m.mutex.Lock()
+
+	for _, slot := range m.slots {
+		if slot.Stream == key {
+			slot.Priority = tunerWarmPriority
+		}
+	}
+
+	m.mutex.Unlock()
+
+}
+
+// Wait : Waits until a tuner is assigned to the stream, at most for the timeout. The requests are served in the order of their arrival.
+// If the context is cancelled or the timeout expires, the request leaves the queue and false is returned.
+func (m *tunerManager) Wait(ctx context.Context, playlistID, key, channelName string, priority int, timeout time.Duration) (ok bool) {
+
+	var waiter = &tunerWaiter{PlaylistID: playlistID, Key: key, ChannelName: channelName, Priority: priority, granted: make(chan struct{})}
+
+	m.mutex.Lock()
+
+	if len(m.waiters) >= tunerQueueLimit {
+		m.mutex.Unlock()
+		showInfo(fmt.Sprintf("Tuner:Channel: %s - Tuner queue is full (%d)", channelName, tunerQueueLimit))
+		return false
+	}
+
+	m.waiters = append(m.waiters, waiter)
+	var position = len(m.waiters)
+
+	m.grant()
+
+	m.mutex.Unlock()
+
+	showInfo(fmt.Sprintf("Tuner:Channel: %s - Waiting for a tuner (Queue: %d, Timeout: %s)", channelName, position, timeout))
+
+	var timer = time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+
+	case <-waiter.granted:
+		showInfo(fmt.Sprintf("Tuner:Channel: %s - Tuner is available", channelName))
+		return true
+
+	case <-ctx.Done():
+
+	case <-timer.C:
+		showInfo(fmt.Sprintf("Tuner:Channel: %s - No tuner became available within %s", channelName, timeout))
+
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i, w := range m.waiters {
+
+		if w == waiter {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			return false
+		}
+
+	}
+
+	// The tuner was assigned while the request was leaving. If no stream uses it yet, it is given to the next request.
+	if _, ok := streamBuffers.Load(key); !ok {
+		delete(m.slots, key)
+		m.grant()
+	}
+
+	return false
+}
+
+// grant : Assigns the free tuners to the waiting requests in the order of their arrival, must be called with the lock held.
+// A request whose provider has no free tuner does not block the requests for other providers.
+func (m *tunerManager) grant() {
+
+	var totalLimit = getTunerCount()
+
+	for i := 0; i < len(m.waiters); {
+
+		var waiter = m.waiters[i]
+
+		// Requests for a channel that is already running share its tuner
+		if _, running := m.slots[waiter.Key]; !running {
+
+			var provider, total = m.count(waiter.PlaylistID)
+
+			if provider >= getTuner(waiter.PlaylistID, getPlaylistType(waiter.PlaylistID)) || total >= totalLimit {
+				i++
+				continue
+			}
+
+			m.slots[waiter.Key] = &tunerSlot{PlaylistID: waiter.PlaylistID, Key: waiter.Key, Stream: waiter.Key, ChannelName: waiter.ChannelName, Priority: waiter.Priority, Started: time.Now()}
+
+		}
+
+		m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+		close(waiter.granted)
+
+	}
+
+}
+
+// count : Tuners in use by the provider and in total, must be called with the lock held
+func (m *tunerManager) count(playlistID string) (provider, total int) {
+
+	for _, slot := range m.slots {
+
+		total++
+
+		if slot.PlaylistID == playlistID {
+			provider++
+		}
+
+	}
+
+	return
+}
+
+// getTunerCount : Number of tuners for all providers together. The tuner setting limits the sum of the tuners of all providers.
+func getTunerCount() (count int) {
+
+	var sum int
+
+	for _, files := range []map[string]interface{}{Settings.Files.M3U, Settings.Files.HDHR} {
+
+		for _, value := range files {
+
+			if data, ok := value.(map[string]interface{}); ok {
+
+				switch tuner := data["tuner"].(type) {
+
+				case float64:
+					sum += int(tuner)
+
+				case int:
+					sum += tuner
+
+				case string:
+					if i, err := strconv.Atoi(tuner); err == nil {
+						sum += i
+					}
+
+				}
+
+			}
+
+		}
+
+	}
+
+	count = Settings.Tuner
+	if count <= 0 || (sum > 0 && sum < count) {
+		count = sum
+	}
+
+	return
+}
+
+// getTunerPriority : Priority of a request, the highest priority of the matching users and IP ranges (default 0)
+func getTunerPriority(r *http.Request) (priority int) {
+
+	if len(Settings.TunerPriorities) == 0 {
+		return
+	}
+
+	var ip = net.ParseIP(getClientIP(r))
+	var username = getRequestUser(r)
+	var matched bool
+
+	for _, rule := range Settings.TunerPriorities {
+
+		var match bool
+
+		if _, network, err := net.ParseCIDR(rule.Match); err == nil {
+			match = ip != nil && network.Contains(ip)
+		} else if address := net.ParseIP(rule.Match); address != nil {
+			match = ip != nil && address.Equal(ip)
+		} else {
+			match = len(username) > 0 && rule.Match == username
+		}
+
+		if match && (!matched || rule.Priority > priority) {
+			priority = rule.Priority
+			matched = true
+		}
+
+	}
+
+	return
+}
+
+// preemptStream : Stops a stream whose tuner (or the tuner of its backup source) was assigned to a stream with a higher priority.
+// The buffer is closed, the clients are disconnected and remove the stream themselves.
+func preemptStream(slot *tunerSlot) {
+
+	if b, ok := streamBuffers.Load(slot.Stream); ok {
+		b.(*streamBuffer).Close(errTunerPreempted)
+	}
+
+}
@@ -0,0 +1,330 @@
+package src
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setTestTuners : Tuner limits of the providers M1 (2 tuners) and M2 (1 tuner) and the tuner setting, the settings are restored after the test
+func setTestTuners(t *testing.T, total int) {
+
+	var settings = Settings
+	t.Cleanup(func() { Settings = settings })
+
+	Settings.Tuner = total
+	Settings.Files.M3U = map[string]interface{}{
+		"M1": map[string]interface{}{"tuner": float64(2)},
+		"M2": map[string]interface{}{"tuner": float64(1)},
+	}
+
+}
+
+// newTestTuners : Tuner manager with the slots, the first slot is the oldest one
+func newTestTuners(slots []tunerSlot) *tunerManager {
+
+	var m = &tunerManager{slots: make(map[string]*tunerSlot)}
+
+	for i := range slots {
+
+		var slot = slots[i]
+		slot.Stream = slot.Key
+		slot.Started = time.Now().Add(time.Duration(i-len(slots)) * time.Minute)
+		m.slots[slot.Key] = &slot
+
+	}
+
+	return m
+}
+
+func TestTunerAcquire(t *testing.T) {
+
+	var tests = []struct {
+		name      string
+		total     int
+		slots     []tunerSlot
+		request   tunerSlot
+		ok        bool
+		preempted string
+	}{
+		{
+			name:    "free tuner",
+			slots:   []tunerSlot{{PlaylistID: "M1", Key: "a"}},
+			request: tunerSlot{PlaylistID: "M1", Key: "b"},
+			ok:      true,
+		},
+		{
+			name:    "running stream",
+			slots:   []tunerSlot{{PlaylistID: "M1", Key: "a"}, {PlaylistID: "M1", Key: "b"}},
+			request: tunerSlot{PlaylistID: "M1", Key: "a", Priority: 5},
+			ok:      true,
+		},
+		{
+			name:    "provider limit",
+			slots:   []tunerSlot{{PlaylistID: "M1", Key: "a"}, {PlaylistID: "M1", Key: "b"}},
+			request: tunerSlot{PlaylistID: "M1", Key: "c"},
+			ok:      false,
+		},
+		{
+			name:    "total limit",
+			total:   2,
+			slots:   []tunerSlot{{PlaylistID: "M1", Key: "a"}, {PlaylistID: "M2", Key: "x"}},
+			request: tunerSlot{PlaylistID: "M1", Key: "c"},
+			ok:      false,
+		},
+		{
+			name:      "lower priority is stopped",
+			slots:     []tunerSlot{{PlaylistID: "M1", Key: "a"}, {PlaylistID: "M1", Key: "b", Priority: 1}},
+			request:   tunerSlot{PlaylistID: "M1", Key: "c", Priority: 1},
+			ok:        true,
+			preempted: "a",
+		},
+		{
+			name:      "newest stream of the lowest priority is stopped",
+			slots:     []tunerSlot{{PlaylistID: "M1", Key: "a"}, {PlaylistID: "M1", Key: "b"}},
+			request:   tunerSlot{PlaylistID: "M1", Key: "c", Priority: 5},
+			ok:        true,
+			preempted: "b",
+		},
+		{
+			name:      "warm stream is stopped",
+			slots:     []tunerSlot{{PlaylistID: "M1", Key: "a", Priority: tunerWarmPriority}, {PlaylistID: "M1", Key: "b"}},
+			request:   tunerSlot{PlaylistID: "M1", Key: "c"},
+			ok:        true,
+			preempted: "a",
+		},
+		{
+			name:    "stream of another provider keeps its tuner if the provider is full",
+			slots:   []tunerSlot{{PlaylistID: "M1", Key: "a", Priority: 3}, {PlaylistID: "M1", Key: "b", Priority: 3}, {PlaylistID: "M2", Key: "x", Priority: -5}},
+			request: tunerSlot{PlaylistID: "M1", Key: "c", Priority: 1},
+			ok:      false,
+		},
+		{
+			name:      "stream of another provider is stopped at the total limit",
+			total:     2,
+			slots:     []tunerSlot{{PlaylistID: "M1", Key: "a"}, {PlaylistID: "M2", Key: "x", Priority: -5}},
+			request:   tunerSlot{PlaylistID: "M1", Key: "c"},
+			ok:        true,
+			preempted: "x",
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			setTestTuners(t, test.total)
+
+			var m = newTestTuners(test.slots)
+
+			// Buffers of the running streams, the buffer of a stopped stream is closed
+			var buffers = make(map[string]*streamBuffer)
+
+			for key := range m.slots {
+				buffers[key] = newTestBuffer(testSegmentSize, bufferSegments)
+				streamBuffers.Store(key, buffers[key])
+			}
+
+			defer func() {
+				for key, buffer := range buffers {
+					buffer.Close(nil)
+					streamBuffers.Delete(key)
+				}
+			}()
+
+			var request = test.request
+			request.Stream = request.Key
+
+			if ok := m.acquire(&request); ok != test.ok {
+				t.Fatalf("acquire() = %t, want %t", ok, test.ok)
+			}
+
+			for key, buffer := range buffers {
+
+				var preempted = key == test.preempted
+
+				if buffer.Closed() != preempted || m.Holds(key) == preempted {
+					t.Errorf("stream %s: stopped = %t, tuner = %t, want %t, %t", key, buffer.Closed(), m.Holds(key), preempted, !preempted)
+				}
+
+			}
+
+			if test.ok && m.slots[request.Key].Priority < request.Priority {
+				t.Errorf("priority of the stream = %d, want %d", m.slots[request.Key].Priority, request.Priority)
+			}
+
+		})
+
+	}
+
+}
+
+func TestTunerGrant(t *testing.T) {
+
+	var tests = []struct {
+		name    string
+		slots   []tunerSlot
+		waiters []string // Playlist ID and key of the waiting requests
+		granted []string
+	}{
+		{
+			name:    "free tuner",
+			slots:   []tunerSlot{{PlaylistID: "M1", Key: "a"}},
+			waiters: []string{"M1/c"},
+			granted: []string{"M1/c"},
+		},
+		{
+			name:    "order of arrival",
+			slots:   []tunerSlot{{PlaylistID: "M1", Key: "a"}},
+			waiters: []string{"M1/c", "M1/d"},
+			granted: []string{"M1/c"},
+		},
+		{
+			name:    "full provider does not block other providers",
+			slots:   []tunerSlot{{PlaylistID: "M1", Key: "a"}, {PlaylistID: "M1", Key: "b"}},
+			waiters: []string{"M1/c", "M2/x"},
+			granted: []string{"M2/x"},
+		},
+		{
+			name:    "running channel shares its tuner",
+			slots:   []tunerSlot{{PlaylistID: "M1", Key: "a"}, {PlaylistID: "M1", Key: "b"}},
+			waiters: []string{"M1/c", "M1/a"},
+			granted: []string{"M1/a"},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			setTestTuners(t, 0)
+
+			var m = newTestTuners(test.slots)
+			var waiters = make(map[string]*tunerWaiter)
+
+			for _, waiter := range test.waiters {
+
+				var playlistID, key, _ = strings.Cut(waiter, "/")
+
+				waiters[waiter] = &tunerWaiter{PlaylistID: playlistID, Key: key, granted: make(chan struct{})}
+				m.waiters = append(m.waiters, waiters[waiter])
+
+			}
+
+			m.mutex.Lock()
+			m.grant()
+			m.mutex.Unlock()
+
+			for name, waiter := range waiters {
+
+				var granted = slices.Contains(test.granted, name)
+
+				select {
+
+				case <-waiter.granted:
+					if !granted {
+						t.Errorf("%s received a tuner", name)
+					}
+
+				default:
+					if granted {
+						t.Errorf("%s is still waiting", name)
+					}
+
+				}
+
+				if granted && !m.Holds(waiter.Key) {
+					t.Errorf("%s has no tuner", name)
+				}
+
+			}
+
+			if len(m.waiters) != len(test.waiters)-len(test.granted) {
+				t.Errorf("%d requests are waiting, want %d", len(m.waiters), len(test.waiters)-len(test.granted))
+			}
+
+		})
+
+	}
+
+}
+
+func TestTunerWait(t *testing.T) {
+
+	var tests = []struct {
+		name    string
+		slots   []tunerSlot
+		timeout time.Duration
+		action  func(m *tunerManager, cancel context.CancelFunc) // Runs while the request is waiting
+		ok      bool
+	}{
+		{
+			name:    "free tuner",
+			slots:   []tunerSlot{{PlaylistID: "M1", Key: "a"}},
+			timeout: time.Second,
+			ok:      true,
+		},
+		{
+			name:    "released tuner",
+			slots:   []tunerSlot{{PlaylistID: "M1", Key: "a"}, {PlaylistID: "M1", Key: "b"}},
+			timeout: 10 * time.Second,
+			action:  func(m *tunerManager, _ context.CancelFunc) { m.Release("a") },
+			ok:      true,
+		},
+		{
+			name:    "timeout",
+			slots:   []tunerSlot{{PlaylistID: "M1", Key: "a"}, {PlaylistID: "M1", Key: "b"}},
+			timeout: 50 * time.Millisecond,
+			ok:      false,
+		},
+		{
+			name:    "client disconnected",
+			slots:   []tunerSlot{{PlaylistID: "M1", Key: "a"}, {PlaylistID: "M1", Key: "b"}},
+			timeout: 10 * time.Second,
+			action:  func(_ *tunerManager, cancel context.CancelFunc) { cancel() },
+			ok:      false,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			setTestTuners(t, 0)
+
+			var m = newTestTuners(test.slots)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var result = make(chan bool)
+			go func() { result <- m.Wait(ctx, "M1", "c", "Channel", 0, test.timeout) }()
+
+			if test.action != nil {
+
+				// Wait until the request is in the queue
+				for queued := false; !queued; time.Sleep(time.Millisecond) {
+					m.mutex.Lock()
+					queued = len(m.waiters) > 0
+					m.mutex.Unlock()
+				}
+
+				test.action(m, cancel)
+
+			}
+
+			if ok := <-result; ok != test.ok {
+				t.Fatalf("Wait() = %t, want %t", ok, test.ok)
+			}
+
+			if m.Holds("c") != test.ok || len(m.waiters) != 0 {
+				t.Errorf("tuner = %t, waiting requests = %d, want %t, 0", m.Holds("c"), len(m.waiters), test.ok)
+			}
+
+		})
+
+	}
+
+}
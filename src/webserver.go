@@ -36,6 +36,9 @@ type RequestStruct struct {
         Settings struct {
                 API                      *bool     `json:"api,omitempty"`
                 SSDP                     *bool     `json:"ssdp,omitempty"`
+                StreamSigning            *bool     `json:"stream.signing,omitempty"`
+                StreamSigningExpiry      *int      `json:"stream.signing.expiry.hours,omitempty"`
+                StreamSigningGrace       *int      `json:"stream.signing.grace.hours,omitempty"`
                 AuthenticationAPI        *bool     `json:"authentication.api,omitempty"`
                 AuthenticationM3U        *bool     `json:"authentication.m3u,omitempty"`
                 AuthenticationPMS        *bool     `json:"authentication.pms,omitempty"`
@@ -46,6 +49,16 @@ type RequestStruct struct {
                 Buffer                   *string   `json:"buffer,omitempty"`
                 BufferSize               *int      `json:"buffer.size.kb,omitempty"`
                 BufferTimeout            *float64  `json:"buffer.timeout,omitempty"`
+                BufferStreamQuota        *int      `json:"buffer.quota.stream.mb,omitempty"`
+                BufferTotalQuota         *int      `json:"buffer.quota.total.mb,omitempty"`
+                BufferTimeShift          *int      `json:"buffer.timeshift.minutes,omitempty"`
+                BufferFailback           *int      `json:"buffer.failback.minutes,omitempty"`
+                BufferLinger             *int      `json:"buffer.linger.sec,omitempty"`
+                BufferSlates             *bool     `json:"buffer.slates,omitempty"`
+                StreamHeadProbe          *bool     `json:"stream.head.probe,omitempty"`
+                M3U8AdaptiveBandwidthMBPS *int     `json:"m3u8.adaptive.bandwidth.mbps,omitempty"`
+                BufferProfiles           *map[string]BufferProfile `json:"buffer.profiles,omitempty"`
+                BufferProfileGroups      *map[string]string        `json:"buffer.profile.groups,omitempty"`
                 CacheImages              *bool     `json:"cache.images,omitempty"`
                 EpgSource                *string   `json:"epgSource,omitempty"`
                 FFmpegOptions            *string   `json:"ffmpeg.options,omitempty"`
@@ -53,7 +66,16 @@ type RequestStruct struct {
                 FilesUpdate              *bool     `json:"files.update,omitempty"`
                 TempPath                 *string   `json:"temp.path,omitempty"`
                 Tuner                    *int      `json:"tuner,omitempty"`
+                TunerPriorities          *[]TunerPriority `json:"tuner.priorities,omitempty"`
+                TunerQueue               *int      `json:"tuner.queue.sec,omitempty"`
+                TranscodePath            *string   `json:"transcode.path,omitempty"`
+                TranscodeProfiles        *map[string]BufferProfile `json:"transcode.profiles,omitempty"`
+                RecordingsPath           *string   `json:"recordings.path,omitempty"`
+                RecordingPaddingStart    *int      `json:"recording.padding.start.minutes,omitempty"`
+                RecordingPaddingEnd      *int      `json:"recording.padding.end.minutes,omitempty"`
+                RecordingRules           *[]RecordingRule `json:"recording.rules,omitempty"`
                 UDPxy                    *string   `json:"udpxy,omitempty"`
+                UDPInterface             *string   `json:"udp.interface,omitempty"`
                 Update                   *[]string `json:"update,omitempty"`
                 UserAgent                *string   `json:"user.agent,omitempty"`
                 XepgReplaceMissingImages *bool     `json:"xepg.replace.missing.images,omitempty"`
@@ -98,28 +120,37 @@ type RequestStruct struct {
 
         // Probe Url
         ProbeURL string `json:"probeURL,omitempty"`
+
+        // Streaming session that is terminated
+        SessionID string `json:"sessionID,omitempty"`
+
+        // Recording that is deleted
+        RecordingID string `json:"recordingID,omitempty"`
 }
 
 // ResponseStruct: Responses to the client (WEB)
 type ResponseStruct struct {
         ClientInfo struct {
-                ARCH           string `json:"arch"`
-                Branch         string `json:"branch,omitempty"`
-                DVR            string `json:"DVR"`
-                EpgSource      string `json:"epgSource"`
-                Errors         int    `json:"errors"`
-                M3U            string `json:"m3u-url,required"`
-                OS             string `json:"os"`
-                Streams        string `json:"streams"`
-                ActiveClients  int    `json:"activeClients"`
-                TotalClients   int    `json:"totalClients"`
-                ActivePlaylist int    `json:"activePlaylist"`
-                TotalPlaylist  int    `json:"totalPlaylist"`
-                UUID           string `json:"uuid"`
-                Version        string `json:"version"`
-                Warnings       int    `json:"warnings"`
-                XEPGCount      int64  `json:"xepg"`
-                XML            string `json:"xepg-url,required"`
+                ARCH           string            `json:"arch"`
+                Bandwidth      []StreamBandwidth `json:"bandwidth"`
+                BandwidthIn    string            `json:"bandwidthIn"`
+                BandwidthOut   string            `json:"bandwidthOut"`
+                Branch         string            `json:"branch,omitempty"`
+                DVR            string            `json:"DVR"`
+                EpgSource      string            `json:"epgSource"`
+                Errors         int               `json:"errors"`
+                M3U            string            `json:"m3u-url,required"`
+                OS             string            `json:"os"`
+                Streams        string            `json:"streams"`
+                ActiveClients  int               `json:"activeClients"`
+                TotalClients   int               `json:"totalClients"`
+                ActivePlaylist int               `json:"activePlaylist"`
+                TotalPlaylist  int               `json:"totalPlaylist"`
+                UUID           string            `json:"uuid"`
+                Version        string            `json:"version"`
+                Warnings       int               `json:"warnings"`
+                XEPGCount      int64             `json:"xepg"`
+                XML            string            `json:"xepg-url,required"`
         } `json:"clientInfo,omitempty"`
 
         Data struct {
@@ -153,6 +184,8 @@ type ResponseStruct struct {
         Wizard              int                    `json:"wizard,omitempty"`
         XEPG                map[string]interface{} `json:"xepg,required"`
         ProbeInfo           ProbeInfoStruct        `json:"probeInfo,omitempty"`
+        Sessions            []StreamSession        `json:"sessions,omitempty"`
+        Recordings          []Recording            `json:"recordings,omitempty"`
 
         Notification map[string]Notification `json:"notification,omitempty"`
 }
@@ -165,26 +198,37 @@ type ProbeInfoStruct struct {
 
 // APIRequestStruct: Request via the API interface
 type APIRequestStruct struct {
-        Cmd      string `json:"cmd"`
-        Password string `json:"password"`
-        Token    string `json:"token"`
-        Username string `json:"username"`
+        Cmd         string `json:"cmd"`
+        Password    string `json:"password"`
+        RecordingID string `json:"recording.id,omitempty"`
+        SessionID   string `json:"session.id,omitempty"`
+        SlateData   string `json:"slate.data,omitempty"`
+        SlateName   string `json:"slate.name,omitempty"`
+        SlateText   string `json:"slate.text,omitempty"`
+        Token       string `json:"token"`
+        Username    string `json:"username"`
 }
 
 // APIResponseStruct: Response to the client (API)
 type APIResponseStruct struct {
-        EpgSource        string `json:"epg.source,omitempty"`
-        Error            string `json:"err,omitempty"`
-        Status           bool   `json:"status,required"`
-        StreamsActive    int64  `json:"streams.active,omitempty"`
-        StreamsAll       int64  `json:"streams.all,omitempty"`
-        StreamsXepg      int64  `json:"streams.xepg,omitempty"`
-        Token            string `json:"token,omitempty"`
-        URLDvr           string `json:"url.dvr,omitempty"`
-        URLM3U           string `json:"url.m3u,omitempty"`
-        URLXepg          string `json:"url.xepg,omitempty"`
-        VersionAPI       string `json:"version.api,omitempty"`
-        VersionThreadfin string `json:"version.threadfin,omitempty"`
+        Bandwidth        []StreamBandwidth `json:"bandwidth,omitempty"`
+        BandwidthIn      int               `json:"bandwidth.in,omitempty"`
+        BandwidthOut     int               `json:"bandwidth.out,omitempty"`
+        EpgSource        string            `json:"epg.source,omitempty"`
+        Error            string            `json:"err,omitempty"`
+        Recordings       []Recording       `json:"recordings,omitempty"`
+        Sessions         []StreamSession   `json:"sessions,omitempty"`
+        Slates           []SlateInfo       `json:"slates,omitempty"`
+        Status           bool              `json:"status,required"`
+        StreamsActive    int64             `json:"streams.active,omitempty"`
+        StreamsAll       int64             `json:"streams.all,omitempty"`
+        StreamsXepg      int64             `json:"streams.xepg,omitempty"`
+        Token            string            `json:"token,omitempty"`
+        URLDvr           string            `json:"url.dvr,omitempty"`
+        URLM3U           string            `json:"url.m3u,omitempty"`
+        URLXepg          string            `json:"url.xepg,omitempty"`
+        VersionAPI       string            `json:"version.api,omitempty"`
+        VersionThreadfin string            `json:"version.threadfin,omitempty"`
 }
 
 // WebScreenLogStruct: Logs are stored in RAM and provided for the web interface
@@ -207,6 +251,7 @@ func StartWebserver() (err error) {
 
 	http.HandleFunc("/", Index)
 	http.HandleFunc("/stream/", Stream)
+	http.HandleFunc("/recordings/", Recordings)
 	http.HandleFunc("/xmltv/", Threadfin)
 	http.HandleFunc("/m3u/", Threadfin)
 	http.HandleFunc("/data/", WS)
@@ -273,7 +318,7 @@ func Index(w http.ResponseWriter, r *http.Request) {
 		} else {
 			systemMutex.Unlock()
 		}
-		response, err = getLineup()
+		response, err = getLineup(getRequestUser(r))
 		w.Header().Set("Content-Type", "application/json")
 	case "/device.xml", "/capability":
 		response, err = getCapability()
@@ -295,16 +340,34 @@ func Index(w http.ResponseWriter, r *http.Request) {
 
 // Stream : Web Server /stream/
 func Stream(w http.ResponseWriter, r *http.Request) {
-	var path = strings.Replace(r.RequestURI, "/stream/", "", 1)
-	streamInfo, err := getStreamInfo(path)
+	var path = strings.TrimPrefix(r.URL.Path, "/stream/")
+
+	// HLS: /stream/<urlID>/index.m3u8 and /stream/<urlID>/<sequence>.ts
+	urlID, file, _ := strings.Cut(path, "/")
+
+	streamInfo, err := getStreamInfo(urlID)
 	if err != nil {
 		ShowError(err, 1203)
 		httpStatusError(w, r, 404)
 		return
 	}
 
+	// Signed streaming URLs are checked when the client connects. The playlist and segment requests of an active HLS session
+	// of the same channel were already checked, all other requests (TS, HEAD) are always checked.
+	if len(file) == 0 || getHLSSession(r.URL.Query().Get("session"), urlID) == nil {
+
+		r, err = verifyStreamingURL(urlID, r)
+		if err != nil {
+			ShowError(err, 1205)
+			httpStatusError(w, r, 403)
+			return
+		}
+
+	}
+
 	// If an UDPxy host is set, and the stream URL is multicast (i.e. starts with 'udp://@'),
 	// then streamInfo.URL needs to be rewritten to point to UDPxy.
+	// Without UDPxy, the Threadfin buffer joins the multicast group itself.
 	if Settings.UDPxy != "" && strings.HasPrefix(streamInfo.URL, "udp://@") {
 		streamInfo.URL = fmt.Sprintf("http://%s/udp/%s/", Settings.UDPxy, strings.TrimPrefix(streamInfo.URL, "udp://@"))
 	}
@@ -313,7 +376,7 @@ func Stream(w http.ResponseWriter, r *http.Request) {
 	forceHttps := Settings.ForceHttps
 	systemMutex.Unlock()
 
-	if forceHttps {
+	if forceHttps && !isMulticastURL(streamInfo.URL) {
 		u, err := url.Parse(streamInfo.URL)
 		if err == nil {
 			u.Scheme = "https"
@@ -325,51 +388,24 @@ func Stream(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if r.Method == "HEAD" {
-		client := &http.Client{}
-		req, err := http.NewRequest("HEAD", streamInfo.URL, nil)
-		if err != nil {
-			ShowError(err, 1501)
-			httpStatusError(w, r, 405)
-			return
-		}
-		resp, err := client.Do(req)
-		if err != nil {
-			ShowError(err, 1502)
-			httpStatusError(w, r, 405)
-			return
-		}
-		defer resp.Body.Close()
-		// Copy headers from the source HEAD response to the outgoing response
-		for key, values := range resp.Header {
-			for _, value := range values {
-				w.Header().Add(key, value)
-			}
-		}
+	if len(file) > 0 {
+		streamHLS(urlID, streamInfo, file, w, r)
 		return
 	}
 
-	var playListBuffer string
-	systemMutex.Lock()
-	playListInterface := Settings.Files.M3U[streamInfo.PlaylistID]
-	if playListInterface == nil {
-		playListInterface = Settings.Files.HDHR[streamInfo.PlaylistID]
+	// HEAD requests are answered by Threadfin, the provider does not count them as a connection
+	if r.Method == "HEAD" {
+		answerStreamHead(streamInfo, w, r)
+		return
 	}
-        playListBuffer = "ffmpeg"
-	systemMutex.Unlock()
 
-	switch playListBuffer {
-        case "ffmpeg":
-                showInfo(fmt.Sprintf("Buffer:true [%s]", playListBuffer))
-        }
+	var playListBuffer = getBufferType(streamInfo.PlaylistID, getPlaylistType(streamInfo.PlaylistID))
 
+	showInfo(fmt.Sprintf("Buffer:true [%s]", playListBuffer))
 	showInfo(fmt.Sprintf("Channel Name:%s", streamInfo.Name))
 	showInfo(fmt.Sprintf("Client User-Agent:%s", r.Header.Get("User-Agent")))
 
-	switch playListBuffer {
-        case "ffmpeg":
-		bufferingStream(streamInfo.PlaylistID, streamInfo.URL, streamInfo.BackupChannel1, streamInfo.BackupChannel2, streamInfo.BackupChannel3, streamInfo.Name, w, r)
-        }
+	bufferingStream(streamInfo.PlaylistID, streamInfo.URL, streamInfo.BackupChannels, streamInfo.Name, streamInfo.BufferProfile, streamInfo.TimeShift, w, r)
 	return
 }
 
@@ -439,8 +475,8 @@ func Threadfin(w http.ResponseWriter, r *http.Request) {
 		systemMutex.Unlock()
 
 		queries := r.URL.Query()
-		// Check if the m3u file exists
-		if len(queries) == 0 {
+		// Check if the m3u file exists. Signed streaming URLs expire, the M3U is created for every request.
+		if len(queries) == 0 && !Settings.StreamSigning {
 			if _, err := os.Stat(m3uFilePath); err == nil {
 				log.Println("Serving existing m3u file")
 				http.ServeFile(w, r, m3uFilePath)
@@ -457,7 +493,7 @@ func Threadfin(w http.ResponseWriter, r *http.Request) {
 			groups = strings.Split(groupTitle, ",")
 		}
 
-		content, err = buildM3U(groups)
+		content, err = buildM3U(groups, getRequestUser(r))
 		if err != nil {
 			ShowError(err, 000)
 		}
@@ -619,6 +655,7 @@ func WS(w http.ResponseWriter, r *http.Request) {
 		// Data write commands
 		case "saveSettings":
 			var authenticationUpdate = Settings.AuthenticationWEB
+			var slates, transcodePath = Settings.BufferSlates, Settings.TranscodePath
 			response.Settings, err = updateServerSettings(request)
 			if err == nil {
 				response.OpenMenu = strconv.Itoa(indexOfString("settings", System.WEB.Menu))
@@ -628,6 +665,11 @@ func WS(w http.ResponseWriter, r *http.Request) {
 				}
 
 				initBufferVFS()
+
+				// The missing slates are only created if the slates or the FFmpeg for them have been changed
+				if Settings.BufferSlates != slates || Settings.TranscodePath != transcodePath {
+					go initSlates()
+				}
 			}
 
 		case "saveFilesM3U":
@@ -772,6 +814,24 @@ func WS(w http.ResponseWriter, r *http.Request) {
 			resolution, frameRate, audioChannels, _ := probeChannel(request)
 			response.ProbeInfo = ProbeInfoStruct{Resolution: resolution, FrameRate: frameRate, AudioChannel: audioChannels}
 
+		case "getSessions":
+			response.Sessions = getStreamSessions()
+
+		case "killSession":
+			err = killStreamSession(request.SessionID)
+			if err == nil {
+				response.Sessions = getStreamSessions()
+			}
+
+		case "getRecordings":
+			response.Recordings = getRecordings()
+
+		case "deleteRecording":
+			err = deleteRecording(request.RecordingID)
+			if err == nil {
+				response.Recordings = getRecordings()
+			}
+
 		default:
 			fmt.Println("+ + + + + + + + + + +", request.Cmd)
 		}
@@ -1109,6 +1169,33 @@ func API(w http.ResponseWriter, r *http.Request) {
 	case "update.xepg":
 		buildXEPG(false)
 
+	case "sessions":
+		response.Sessions = getStreamSessions()
+
+	case "bandwidth":
+		response.Bandwidth, response.BandwidthIn, response.BandwidthOut = getStreamBandwidth()
+
+	case "kill.session":
+		err = killStreamSession(request.SessionID)
+
+	case "recordings":
+		response.Recordings = getRecordings()
+
+	case "delete.recording":
+		err = deleteRecording(request.RecordingID)
+
+	case "slates":
+		response.Slates = getSlates()
+
+	case "upload.slate":
+		err = uploadSlate(request.SlateName, request.SlateData)
+
+	case "generate.slate":
+		err = generateSlate(request.SlateName, request.SlateText)
+
+	case "delete.slate":
+		err = deleteSlate(request.SlateName)
+
 	default:
 		err = errors.New(getErrMsg(5000))
 
@@ -1183,8 +1270,13 @@ func setDefaultResponseData(response ResponseStruct, data bool) (defaults Respon
 	defaults.ClientInfo.Warnings = WebScreenLog.Warnings
 	defaults.ClientInfo.ActiveClients = getActiveClientCount()
 	defaults.ClientInfo.ActivePlaylist = getActivePlaylistCount()
-	defaults.ClientInfo.TotalClients = Settings.Tuner
+	defaults.ClientInfo.TotalClients = getTunerCount()
 	defaults.ClientInfo.TotalPlaylist = totalPlaylistCount
+
+	var ingress, egress int
+	defaults.ClientInfo.Bandwidth, ingress, egress = getStreamBandwidth()
+	defaults.ClientInfo.BandwidthIn = formatBitrate(ingress)
+	defaults.ClientInfo.BandwidthOut = formatBitrate(egress)
 	defaults.Notification = System.Notification
 	defaults.Log = WebScreenLog
 
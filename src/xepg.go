@@ -233,7 +233,7 @@ func buildXEPG(background bool) {
 
 	var err error
 
-	Data.Cache.Images, err = imgcache.New(System.Folder.ImagesCache, fmt.Sprintf("%s://%s/images/", System.ServerProtocol.WEB, System.Domain), Settings.CacheImages)
+	Data.Cache.Images, err = imgcache.New(System.Folder.ImagesCache, fmt.Sprintf("%s://%s/images/", System.ServerProtocol.WEB, System.Domain), Settings.CacheImages, downloadImage)
 	if err != nil {
 		ShowError(err, 0)
 	}
@@ -336,7 +336,7 @@ func buildXEPG(background bool) {
 
 	} else {
 
-		getLineup()
+		getLineup("")
 		System.ScanInProgress = 0
 
 	}
@@ -394,6 +394,7 @@ func createXEPGMapping() {
 
 					channel["id"] = c.ID
 					channel["display-name"] = friendlyDisplayName(*c)
+					setImageSource(c.Icon.Src, fileID, "xmltv")
 					channel["icon"] = imgc.Image.GetURL(c.Icon.Src, Settings.HttpThreadfinDomain, Settings.Port, Settings.ForceHttps, Settings.HttpsPort, Settings.HttpsThreadfinDomain)
 					channel["active"] = c.Active
 
@@ -463,6 +464,11 @@ func createXEPGDatabase() (err error) {
 		return err
 	}
 
+	err = migrateBackupChannels()
+	if err != nil {
+		return
+	}
+
 	settings, err := loadJSONFileToMap(System.File.Settings)
 	if err != nil || len(settings) == 0 {
 		return
@@ -680,6 +686,7 @@ func createXEPGDatabase() (err error) {
                                 // Update channel logo. Will be overwritten by existing logo in the XMLTV file
 				if xepgChannel.XUpdateChannelIcon {
 					var imgc = Data.Cache.Images
+					setImageSource(m3uChannel.TvgLogo, m3uChannel.FileM3UID, "m3u")
 					xepgChannel.TvgLogo = imgc.Image.GetURL(m3uChannel.TvgLogo, Settings.HttpThreadfinDomain, Settings.Port, Settings.ForceHttps, Settings.HttpsPort, Settings.HttpsThreadfinDomain)
 				}
 			}
@@ -809,6 +816,11 @@ func createXEPGDatabase() (err error) {
 func mapping() (err error) {
 	showInfo("XEPG:" + "Map channels")
 
+	backupIndex, err := getBackupChannelIndex()
+	if err != nil {
+		return
+	}
+
 	for xepg, dxc := range Data.XEPG.Channels {
 
 		var xepgChannel XEPGChannelStruct
@@ -821,35 +833,9 @@ func mapping() (err error) {
 			xepgChannel.TvgName = xepgChannel.Name
 		}
 
-		if (xepgChannel.XBackupChannel1 != "" && xepgChannel.XBackupChannel1 != "-") || (xepgChannel.XBackupChannel2 != "" && xepgChannel.XBackupChannel2 != "-") || (xepgChannel.XBackupChannel3 != "" && xepgChannel.XBackupChannel3 != "-") {
-			for _, stream := range Data.Streams.Active {
-				var m3uChannel M3UChannelStructXEPG
-
-				err = json.Unmarshal([]byte(mapToJSON(stream)), &m3uChannel)
-				if err != nil {
-					return err
-				}
-
-				if m3uChannel.TvgName == "" {
-					m3uChannel.TvgName = m3uChannel.Name
-				}
-
-				backup_channel1 := strings.Trim(xepgChannel.XBackupChannel1, " ")
-				if m3uChannel.TvgName == backup_channel1 {
-					xepgChannel.BackupChannel1 = &BackupStream{PlaylistID: m3uChannel.FileM3UID, URL: m3uChannel.URL}
-				}
-
-				backup_channel2 := strings.Trim(xepgChannel.XBackupChannel2, " ")
-				if m3uChannel.TvgName == backup_channel2 {
-					xepgChannel.BackupChannel2 = &BackupStream{PlaylistID: m3uChannel.FileM3UID, URL: m3uChannel.URL}
-				}
-
-				backup_channel3 := strings.Trim(xepgChannel.XBackupChannel3, " ")
-				if m3uChannel.TvgName == backup_channel3 {
-					xepgChannel.BackupChannel3 = &BackupStream{PlaylistID: m3uChannel.FileM3UID, URL: m3uChannel.URL}
-				}
-			}
-		}
+		// Streaming URLs of the backup channels from the current playlists
+		xepgChannel.BackupChannels = getBackupStreams(xepgChannel.XBackupChannels, backupIndex)
+		Data.XEPG.Channels[xepg] = xepgChannel
 
                 // Automatic mapping for new channels. Only executed if the channel is disabled and no XMLTV file and no XMLTV channel is assigned
 		if !xepgChannel.XActive {
@@ -992,6 +978,131 @@ func mapping() (err error) {
 	return
 }
 
+// getBackupChannelIndex : Channels of all playlists that can be used as backup channels (playlist ID and channel reference)
+func getBackupChannelIndex() (index map[string]M3UChannelStructXEPG, err error) {
+
+	index = make(map[string]M3UChannelStructXEPG)
+
+	for _, stream := range Data.Streams.Active {
+
+		var m3uChannel M3UChannelStructXEPG
+
+		err = json.Unmarshal([]byte(mapToJSON(stream)), &m3uChannel)
+		if err != nil {
+			return
+		}
+
+		if m3uChannel.TvgName == "" {
+			m3uChannel.TvgName = m3uChannel.Name
+		}
+
+		// Without a playlist ID, the first channel with the tvg-name is used (older databases)
+		var keys = []string{backupChannelKey(m3uChannel.FileM3UID, m3uChannel.TvgName), backupChannelKey("", m3uChannel.TvgName)}
+		if len(m3uChannel.UUIDValue) > 0 {
+			keys = append(keys, backupChannelKey(m3uChannel.FileM3UID, m3uChannel.UUIDValue))
+		}
+
+		for _, key := range keys {
+			if _, ok := index[key]; !ok {
+				index[key] = m3uChannel
+			}
+		}
+
+	}
+
+	return
+}
+
+// backupChannelKey : Key of a channel in the backup channel index
+func backupChannelKey(playlistID, channel string) string {
+	return playlistID + ":" + strings.TrimSpace(channel)
+}
+
+// getBackupStreams : Streaming URLs of the backup channels, channels that no longer exist are skipped
+func getBackupStreams(sources []BackupSource, index map[string]M3UChannelStructXEPG) (streams []BackupStream) {
+
+	for _, source := range sources {
+
+		if m3uChannel, ok := index[backupChannelKey(source.PlaylistID, source.Channel)]; ok {
+			streams = append(streams, BackupStream{PlaylistID: m3uChannel.FileM3UID, URL: m3uChannel.URL})
+		}
+
+	}
+
+	return
+}
+
+// migrateBackupChannels : Converts the backup channels 1 - 3 of older databases (tvg-name) into the list of backup channels
+func migrateBackupChannels() (err error) {
+
+	var index map[string]M3UChannelStructXEPG
+
+	for _, dxc := range Data.XEPG.Channels {
+
+		channel, ok := dxc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var sources []BackupSource
+		var legacy bool
+
+		for i := 1; i <= 3; i++ {
+
+			var key = fmt.Sprintf("x-backup-channel-%d", i)
+
+			value, ok := channel[key].(string)
+			if !ok {
+				continue
+			}
+
+			legacy = true
+			delete(channel, key)
+
+			value = strings.TrimSpace(value)
+			if len(value) == 0 || value == "-" {
+				continue
+			}
+
+			if index == nil {
+				index, err = getBackupChannelIndex()
+				if err != nil {
+					return
+				}
+			}
+
+			var source = BackupSource{Channel: value}
+
+			if m3uChannel, ok := index[backupChannelKey("", value)]; ok {
+
+				source.PlaylistID = m3uChannel.FileM3UID
+				if len(m3uChannel.UUIDValue) > 0 {
+					source.Channel = m3uChannel.UUIDValue
+				}
+
+			}
+
+			sources = append(sources, source)
+
+		}
+
+		if !legacy {
+			continue
+		}
+
+		if _, ok := channel["x-backup-channels"]; !ok {
+			channel["x-backup-channels"] = sources
+		}
+
+		if len(sources) > 0 {
+			showInfo(fmt.Sprintf("XEPG:Channel: %v - Backup channels migrated (%d)", channel["x-name"], len(sources)))
+		}
+
+	}
+
+	return
+}
+
 // Create XMLTV file
 func createXMLTVFile() (err error) {
 
@@ -1051,6 +1162,7 @@ func createXMLTVFile() (err error) {
 					// Channel
 					var channel Channel
 					channel.ID = xepgChannel.XChannelID
+					setImageSource(xepgChannel.TvgLogo, xepgChannel.FileM3UID, "m3u")
 					channel.Icon = Icon{Src: imgc.Image.GetURL(xepgChannel.TvgLogo, Settings.HttpThreadfinDomain, Settings.Port, Settings.ForceHttps, Settings.HttpsPort, Settings.HttpsThreadfinDomain)}
 					channel.DisplayName = append(channel.DisplayName, DisplayName{Value: xepgChannel.XName})
 					channel.Active = xepgChannel.XActive
@@ -1491,7 +1603,10 @@ func getPoster(program *Program, xmltvProgram *Program, xepgChannel XEPGChannelS
 
 	var imgc = Data.Cache.Images
 
+	var fileID = strings.TrimSuffix(xepgChannel.XmltvFile, path.Ext(xepgChannel.XmltvFile))
+
 	for _, poster := range xmltvProgram.Poster {
+		setImageSource(poster.Src, fileID, "xmltv")
 		poster.Src = imgc.Image.GetURL(poster.Src, Settings.HttpThreadfinDomain, Settings.Port, Settings.ForceHttps, Settings.HttpsPort, Settings.HttpsThreadfinDomain)
 		program.Poster = append(program.Poster, poster)
 	}
@@ -1622,13 +1737,16 @@ func isInInactiveList(channelURL string) bool {
 func createM3UFile() {
 
 	showInfo("XEPG:" + fmt.Sprintf("Create M3U file (%s)", System.File.M3U))
-	_, err := buildM3U([]string{})
+	_, err := buildM3U([]string{}, "")
 	if err != nil {
 		ShowError(err, 000)
 	}
 
 	saveMapToJSONFile(System.File.URLS, Data.Cache.StreamingURLS)
 
+	// The warm streams are started and stopped with the new channel list
+	updateWarmChannels()
+
 	return
 }
 